@@ -0,0 +1,264 @@
+package main
+
+import (
+	"aliyun-exporter/internal/cmsutil"
+	"encoding/json"
+	"flag"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/cms"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const namespace = "acs_alb"
+
+type Exporter struct {
+	newStatusMetric map[string]*prometheus.Desc
+	limiter         *cmsutil.SeriesLimiter
+	aggregations    map[string][]cmsutil.Aggregation
+	keepRaw         bool
+	lookback        time.Duration
+	cache           *cmsutil.StaleCache
+}
+
+type Cpu []Datapoint
+
+type Datapoint struct {
+	Timestamp        int64   `json:"timestamp"`
+	UserID           string  `json:"userId"`
+	LoadBalancerID   string  `json:"loadBalancerId"`
+	ListenerProtocol string  `json:"listenerProtocol"`
+	ListenerPort     string  `json:"listenerPort"`
+	ServerGroupID    string  `json:"serverGroupId"`
+	RuleID           string  `json:"ruleId"`
+	Maximum          float64 `json:"Maximum"`
+	Minimum          float64 `json:"Minimum"`
+	Average          float64 `json:"Average"`
+}
+
+var metricLabels = map[string][]string{}
+
+func newECSMetric(metricName string, docString string, labels []string) *prometheus.Desc {
+	metricLabels[metricName] = labels
+	return prometheus.NewDesc(
+		prometheus.BuildFQName("aliyun", "alb", metricName),
+		docString, labels, nil,
+	)
+}
+
+var (
+	loadBalancerLabels = []string{"loadBalancerId"}
+	listenerLabels     = []string{"loadBalancerId", "listenerProtocol", "listenerPort"}
+	ruleLabels         = []string{"loadBalancerId", "listenerProtocol", "listenerPort", "ruleId"}
+	serverGroupLabels  = []string{"loadBalancerId", "serverGroupId"}
+)
+
+func newLoadBalancerMetric(metricName string, docString string) *prometheus.Desc {
+	return newECSMetric(metricName, docString, loadBalancerLabels)
+}
+
+func newListenerMetric(metricName string, docString string) *prometheus.Desc {
+	return newECSMetric(metricName, docString, listenerLabels)
+}
+
+func newRuleMetric(metricName string, docString string) *prometheus.Desc {
+	return newECSMetric(metricName, docString, ruleLabels)
+}
+
+func newServerGroupMetric(metricName string, docString string) *prometheus.Desc {
+	return newECSMetric(metricName, docString, serverGroupLabels)
+}
+
+func newExporter() *Exporter {
+	return &Exporter{
+		newStatusMetric: map[string]*prometheus.Desc{
+			"LoadBalancerActiveConnection":    newLoadBalancerMetric("LoadBalancerActiveConnection", "Active connections of the load balancer."),
+			"LoadBalancerNewConnection":       newLoadBalancerMetric("LoadBalancerNewConnection", "New connections per second of the load balancer."),
+			"LoadBalancerRejectedConnection":  newLoadBalancerMetric("LoadBalancerRejectedConnection", "Connections rejected per second by the load balancer."),
+			"LoadBalancerQPS":                 newLoadBalancerMetric("LoadBalancerQPS", "Requests per second of the load balancer."),
+			"LoadBalancerInBits":              newLoadBalancerMetric("LoadBalancerInBits", "Inbound traffic of the load balancer in bits per second."),
+			"LoadBalancerOutBits":             newLoadBalancerMetric("LoadBalancerOutBits", "Outbound traffic of the load balancer in bits per second."),
+			"LoadBalancerHTTPCode2XX":         newLoadBalancerMetric("LoadBalancerHTTPCode2XX", "2xx responses per second returned by the load balancer."),
+			"LoadBalancerHTTPCode3XX":         newLoadBalancerMetric("LoadBalancerHTTPCode3XX", "3xx responses per second returned by the load balancer."),
+			"LoadBalancerHTTPCode4XX":         newLoadBalancerMetric("LoadBalancerHTTPCode4XX", "4xx responses per second returned by the load balancer."),
+			"LoadBalancerHTTPCode5XX":         newLoadBalancerMetric("LoadBalancerHTTPCode5XX", "5xx responses per second returned by the load balancer."),
+			"LoadBalancerHTTPCodeUpstream2XX": newLoadBalancerMetric("LoadBalancerHTTPCodeUpstream2XX", "2xx responses per second returned by the backends of the load balancer."),
+			"LoadBalancerHTTPCodeUpstream3XX": newLoadBalancerMetric("LoadBalancerHTTPCodeUpstream3XX", "3xx responses per second returned by the backends of the load balancer."),
+			"LoadBalancerHTTPCodeUpstream4XX": newLoadBalancerMetric("LoadBalancerHTTPCodeUpstream4XX", "4xx responses per second returned by the backends of the load balancer."),
+			"LoadBalancerHTTPCodeUpstream5XX": newLoadBalancerMetric("LoadBalancerHTTPCodeUpstream5XX", "5xx responses per second returned by the backends of the load balancer."),
+
+			"ListenerActiveConnection":        newListenerMetric("ListenerActiveConnection", "Active connections of the listener."),
+			"ListenerNewConnection":           newListenerMetric("ListenerNewConnection", "New connections per second of the listener."),
+			"ListenerRejectedConnection":      newListenerMetric("ListenerRejectedConnection", "Connections rejected per second by the listener."),
+			"ListenerQPS":                     newListenerMetric("ListenerQPS", "Requests per second of the listener."),
+			"ListenerInBits":                  newListenerMetric("ListenerInBits", "Inbound traffic of the listener in bits per second."),
+			"ListenerOutBits":                 newListenerMetric("ListenerOutBits", "Outbound traffic of the listener in bits per second."),
+			"ListenerHTTPCode2XX":             newListenerMetric("ListenerHTTPCode2XX", "2xx responses per second returned by the listener."),
+			"ListenerHTTPCode3XX":             newListenerMetric("ListenerHTTPCode3XX", "3xx responses per second returned by the listener."),
+			"ListenerHTTPCode4XX":             newListenerMetric("ListenerHTTPCode4XX", "4xx responses per second returned by the listener."),
+			"ListenerHTTPCode5XX":             newListenerMetric("ListenerHTTPCode5XX", "5xx responses per second returned by the listener."),
+			"ListenerHTTPCodeUpstream2XX":     newListenerMetric("ListenerHTTPCodeUpstream2XX", "2xx responses per second returned by the backends of the listener."),
+			"ListenerHTTPCodeUpstream3XX":     newListenerMetric("ListenerHTTPCodeUpstream3XX", "3xx responses per second returned by the backends of the listener."),
+			"ListenerHTTPCodeUpstream4XX":     newListenerMetric("ListenerHTTPCodeUpstream4XX", "4xx responses per second returned by the backends of the listener."),
+			"ListenerHTTPCodeUpstream5XX":     newListenerMetric("ListenerHTTPCodeUpstream5XX", "5xx responses per second returned by the backends of the listener."),
+			"ListenerUpstreamResponseTime":    newListenerMetric("ListenerUpstreamResponseTime", "Backend response time of the listener in milliseconds."),
+			"ListenerUpstreamConnectionError": newListenerMetric("ListenerUpstreamConnectionError", "Failed backend connections per second of the listener."),
+			"ListenerHealthyHostCount":        newListenerMetric("ListenerHealthyHostCount", "Healthy backend servers of the listener."),
+			"ListenerUnHealthyHostCount":      newListenerMetric("ListenerUnHealthyHostCount", "Unhealthy backend servers of the listener."),
+
+			"RuleQPS":                     newRuleMetric("RuleQPS", "Requests per second matched by the forwarding rule."),
+			"RuleHTTPCodeUpstream2XX":     newRuleMetric("RuleHTTPCodeUpstream2XX", "2xx responses per second returned by the backends of the forwarding rule."),
+			"RuleHTTPCodeUpstream3XX":     newRuleMetric("RuleHTTPCodeUpstream3XX", "3xx responses per second returned by the backends of the forwarding rule."),
+			"RuleHTTPCodeUpstream4XX":     newRuleMetric("RuleHTTPCodeUpstream4XX", "4xx responses per second returned by the backends of the forwarding rule."),
+			"RuleHTTPCodeUpstream5XX":     newRuleMetric("RuleHTTPCodeUpstream5XX", "5xx responses per second returned by the backends of the forwarding rule."),
+			"RuleUpstreamResponseTime":    newRuleMetric("RuleUpstreamResponseTime", "Backend response time of the forwarding rule in milliseconds."),
+			"RuleUpstreamConnectionError": newRuleMetric("RuleUpstreamConnectionError", "Failed backend connections per second of the forwarding rule."),
+
+			"ServerGroupQPS":                     newServerGroupMetric("ServerGroupQPS", "Requests per second sent to the server group."),
+			"ServerGroupHTTPCodeUpstream2XX":     newServerGroupMetric("ServerGroupHTTPCodeUpstream2XX", "2xx responses per second returned by the server group."),
+			"ServerGroupHTTPCodeUpstream3XX":     newServerGroupMetric("ServerGroupHTTPCodeUpstream3XX", "3xx responses per second returned by the server group."),
+			"ServerGroupHTTPCodeUpstream4XX":     newServerGroupMetric("ServerGroupHTTPCodeUpstream4XX", "4xx responses per second returned by the server group."),
+			"ServerGroupHTTPCodeUpstream5XX":     newServerGroupMetric("ServerGroupHTTPCodeUpstream5XX", "5xx responses per second returned by the server group."),
+			"ServerGroupUpstreamResponseTime":    newServerGroupMetric("ServerGroupUpstreamResponseTime", "Response time of the server group in milliseconds."),
+			"ServerGroupUpstreamConnectionError": newServerGroupMetric("ServerGroupUpstreamConnectionError", "Failed connections per second to the server group."),
+			"ServerGroupHealthyHostCount":        newServerGroupMetric("ServerGroupHealthyHostCount", "Healthy backend servers of the server group."),
+			"ServerGroupUnHealthyHostCount":      newServerGroupMetric("ServerGroupUnHealthyHostCount", "Unhealthy backend servers of the server group."),
+		},
+	}
+}
+
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range e.newStatusMetric {
+		ch <- m
+	}
+	for _, aggregations := range e.aggregations {
+		for _, a := range aggregations {
+			ch <- a.Desc
+		}
+	}
+	e.limiter.Describe(ch)
+	e.cache.Describe(ch)
+}
+
+func (e Exporter) Collect(ch chan<- prometheus.Metric) {
+	metrics := make([]string, 0, len(e.newStatusMetric))
+	for metric := range e.newStatusMetric {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	emitted := 0
+	for _, metric := range metrics {
+		datapoints, err := e.cache.Get(namespace, metric, e.fetch)
+		if err != nil {
+			continue
+		}
+		var user Cpu
+		json.Unmarshal([]byte(datapoints), &user)
+		samples := make([]cmsutil.Sample, 0, len(user))
+		seen := map[string]bool{}
+		for _, value := range user {
+			labels := labelValues(metric, value)
+			// A dimension CMS reports under an unexpected key leaves its
+			// label empty and would export duplicate series, failing the
+			// whole scrape.
+			key := strings.Join(labels, "\xff")
+			if seen[key] {
+				log.Printf("%s %s: dropping duplicate series %v", namespace, metric, labels)
+				continue
+			}
+			seen[key] = true
+			samples = append(samples, cmsutil.Sample{Labels: labels, Value: value.Average})
+		}
+		for _, a := range e.aggregations[metric] {
+			for _, s := range e.limiter.Limit(a.Name, a.Apply(samples), &emitted) {
+				ch <- prometheus.MustNewConstMetric(a.Desc, prometheus.GaugeValue, s.Value, s.Labels...)
+			}
+		}
+		if len(e.aggregations[metric]) > 0 && !e.keepRaw {
+			continue
+		}
+		for _, s := range e.limiter.Limit(metric, samples, &emitted) {
+			ch <- prometheus.MustNewConstMetric(e.newStatusMetric[metric], prometheus.GaugeValue, s.Value, s.Labels...)
+		}
+	}
+	e.limiter.Collect(ch)
+	e.cache.Collect(ch)
+}
+
+// labelValues picks the datapoint fields matching the labels of the metric's
+// family.
+func labelValues(metric string, value Datapoint) []string {
+	labels := metricLabels[metric]
+	values := make([]string, len(labels))
+	for i, label := range labels {
+		switch label {
+		case "loadBalancerId":
+			values[i] = value.LoadBalancerID
+		case "listenerProtocol":
+			values[i] = value.ListenerProtocol
+		case "listenerPort":
+			values[i] = value.ListenerPort
+		case "serverGroupId":
+			values[i] = value.ServerGroupID
+		case "ruleId":
+			values[i] = value.RuleID
+		}
+	}
+	return values
+}
+
+func (e Exporter) fetch(namespace string, metric string) (string, error) {
+	client, _ := cms.NewClientWithAccessKey("cn-hangzhou", "secretid", "secretkey")
+	if e.lookback > 0 {
+		return cmsutil.DescribeMetricLatest(client, namespace, metric, e.lookback)
+	}
+	request := cms.CreateDescribeMetricLastRequest()
+	request.Scheme = "https"
+	request.MetricName = metric
+	request.Namespace = namespace
+	request.AcceptFormat = "json"
+	response, err := client.DescribeMetricLast(request)
+	if err != nil {
+		return "", err
+	}
+	return response.Datapoints, nil
+}
+
+var (
+	listenAddress   = flag.String("telemetry.address", ":8027", "Address on which to expose metrics.")
+	metricsEndpoint = flag.String("telemetry.endpoint", "/metrics", "Path under which to expose metrics.")
+	seriesLimit     = flag.Int("series.limit", 0, "Maximum number of series exported per scrape, 0 for no limit.")
+	metricLimits    = flag.String("series.metric-limit", "", "Comma separated per-metric series caps, e.g. ListenerQPS=1000,ServerGroupQPS=1000.")
+	aggregate       = flag.String("aggregate", "", "Comma separated aggregation rules, e.g. ListenerQPS=sum:loadBalancerId.")
+	aggregateRaw    = flag.Bool("aggregate.keep-raw", false, "Export the raw series of aggregated metrics alongside the aggregates.")
+	staleGrace      = flag.Duration("metric.stale-grace", 0, "How long to keep serving the last successful datapoints of a metric while CMS errors, e.g. 10m.")
+	lookback        = flag.Duration("metric.lookback", 0, "Use DescribeMetricList over this window and export the latest datapoint of each series instead of DescribeMetricLast, e.g. 5m.")
+)
+
+func main() {
+	flag.Parse()
+	exporter := newExporter()
+	var err error
+	exporter.aggregations, err = cmsutil.ParseAggregations(*aggregate, exporter.newStatusMetric, metricLabels, newECSMetric)
+	if err != nil {
+		log.Fatal(err)
+	}
+	limits, err := cmsutil.ParseMetricLimits(*metricLimits, exporter.newStatusMetric, exporter.aggregations)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exporter.limiter = cmsutil.NewSeriesLimiter(namespace, *seriesLimit, limits)
+	exporter.keepRaw = *aggregateRaw
+	exporter.lookback = *lookback
+	exporter.cache = cmsutil.NewStaleCache(*staleGrace)
+	prometheus.MustRegister(exporter)
+	prometheus.Unregister(prometheus.NewGoCollector())
+
+	http.Handle(*metricsEndpoint, promhttp.Handler())
+	log.Fatal(http.ListenAndServe(*listenAddress, nil))
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/cms"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"strings"
+)
+
+// collectAgentStatus exports whether the CloudMonitor agent runs on every
+// instance, so that missing agent metrics can be told apart from an idle host.
+func (e Exporter) collectAgentStatus(ch chan<- prometheus.Metric, instances []ecs.Instance) {
+	ids := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		ids = append(ids, instance.InstanceId)
+	}
+
+	cmsClient, _ := cms.NewClientWithAccessKey("cn-hangzhou", "secretid", "secretkey")
+	for start := 0; start < len(ids); start += 50 {
+		end := start + 50
+		if end > len(ids) {
+			end = len(ids)
+		}
+		request := cms.CreateDescribeMonitoringAgentStatusesRequest()
+		request.Scheme = "https"
+		request.InstanceIds = strings.Join(ids[start:end], ",")
+		response, err := cmsClient.DescribeMonitoringAgentStatuses(request)
+		if err != nil {
+			log.Printf("agent status: %v", err)
+			continue
+		}
+		for _, node := range response.NodeStatusList.NodeStatus {
+			var running float64
+			if node.Status == "running" {
+				running = 1
+			}
+			ch <- prometheus.MustNewConstMetric(e.agentRunning, prometheus.GaugeValue, running, node.InstanceId, node.OsMonitorVersion)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var creditLabels = []string{"id", "instance_type"}
+
+// newCreditMetric describes a CPU credit metric of a burstable instance.
+func newCreditMetric(metricName string, docString string) *prometheus.Desc {
+	return newECSMetric(metricName, docString, creditLabels)
+}
+
+func newCreditMetrics() map[string]*prometheus.Desc {
+	return map[string]*prometheus.Desc{
+		"CPUCreditBalance":             newCreditMetric("CPUCreditBalance", "CPU credits accrued and not yet spent by the burstable instance."),
+		"CPUCreditUsage":               newCreditMetric("CPUCreditUsage", "CPU credits spent by the burstable instance."),
+		"CPUNotpaidSurplusCreditUsage": newCreditMetric("CPUNotpaidSurplusCreditUsage", "Surplus CPU credits spent beyond the balance and not paid for yet."),
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+)
+
+// blockStorageNamespace holds the per cloud disk metrics, keyed by disk id
+// rather than by the guest device name the agent reports.
+const blockStorageNamespace = "acs_ebs_dashboard"
+
+var diskLabels = []string{"diskId", "id"}
+
+// diskMetricNames maps the exported name of every per cloud disk metric to its
+// CMS name in blockStorageNamespace.
+var diskMetricNames = map[string]string{}
+
+// newDiskMetric describes a per cloud disk metric. The block storage metrics
+// share their CMS names with the hypervisor metrics, so they are exported and
+// keyed as cloud_disk_<metricName>.
+func newDiskMetric(metricName string, docString string) *prometheus.Desc {
+	diskMetricNames["cloud_disk_"+metricName] = metricName
+	return newECSMetric("cloud_disk_"+metricName, docString, diskLabels)
+}
+
+func newDiskMetrics() map[string]*prometheus.Desc {
+	return map[string]*prometheus.Desc{
+		"cloud_disk_DiskReadBPS":   newDiskMetric("DiskReadBPS", "Bytes read per second from the cloud disk."),
+		"cloud_disk_DiskWriteBPS":  newDiskMetric("DiskWriteBPS", "Bytes written per second to the cloud disk."),
+		"cloud_disk_DiskReadIOPS":  newDiskMetric("DiskReadIOPS", "Read operations per second on the cloud disk."),
+		"cloud_disk_DiskWriteIOPS": newDiskMetric("DiskWriteIOPS", "Write operations per second on the cloud disk."),
+		"cloud_disk_LatencyRead":   newDiskMetric("LatencyRead", "Read latency of the cloud disk in microseconds."),
+		"cloud_disk_LatencyWrite":  newDiskMetric("LatencyWrite", "Write latency of the cloud disk in microseconds."),
+	}
+}
+
+// describeDisks pages through DescribeDisks and returns every cloud disk in
+// the region.
+func describeDisks(client *ecs.Client) ([]ecs.Disk, error) {
+	var disks []ecs.Disk
+	request := ecs.CreateDescribeDisksRequest()
+	request.Scheme = "https"
+	request.PageSize = requests.NewInteger(100)
+	for page := 1; ; page++ {
+		request.PageNumber = requests.NewInteger(page)
+		response, err := client.DescribeDisks(request)
+		if err != nil {
+			return nil, err
+		}
+		disks = append(disks, response.Disks.Disk...)
+		if len(response.Disks.Disk) == 0 || len(disks) >= response.TotalCount {
+			return disks, nil
+		}
+	}
+}
+
+// listDisks returns every cloud disk in the region, or nil when they cannot be
+// described.
+func listDisks() []ecs.Disk {
+	client, err := newECSClient()
+	if err != nil {
+		log.Printf("disks: %v", err)
+		return nil
+	}
+	disks, err := describeDisks(client)
+	if err != nil {
+		log.Printf("disks: %v", err)
+		return nil
+	}
+	return disks
+}
+
+// collectDisks exports the category, performance level, size and attached
+// instance of every cloud disk. Their block storage metrics go through the
+// generic path of Collect.
+func (e Exporter) collectDisks(ch chan<- prometheus.Metric, disks []ecs.Disk) {
+	for _, disk := range disks {
+		ch <- prometheus.MustNewConstMetric(e.diskInfo, prometheus.GaugeValue, 1, disk.DiskId, disk.InstanceId, disk.Category, disk.PerformanceLevel, disk.Type, disk.Device)
+		ch <- prometheus.MustNewConstMetric(e.diskSize, prometheus.GaugeValue, float64(disk.Size)*1024*1024*1024, disk.DiskId, disk.InstanceId)
+	}
+}
@@ -1,20 +1,52 @@
 package main
 
 import (
+	"aliyun-exporter/internal/cmsutil"
 	"encoding/json"
 	"flag"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/cms"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const namespace = "acs_ecs_dashboard"
+
 type Exporter struct {
 	newStatusMetric map[string]*prometheus.Desc
+	agentRunning    *prometheus.Desc
+	agentStatus     bool
+	processes       map[string]bool
+	diskInfo        *prometheus.Desc
+	diskSize        *prometheus.Desc
+	disks           bool
+	inventoryMetric map[string]*prometheus.Desc
+	inventory       bool
+	scheduledEvent  *prometheus.Desc
+	events          bool
+	cpuCredits      bool
+	gpu             bool
+	lastSnapshot    *prometheus.Desc
+	snapshotPolicy  *prometheus.Desc
+	snapshots       bool
+	snapshotPoller  *snapshotPoller
+	limiter         *cmsutil.SeriesLimiter
+	top             map[string]topN
+	aggregations    map[string][]cmsutil.Aggregation
+	keepRaw         bool
+	lookback        time.Duration
+	cache           *cmsutil.StaleCache
 }
 
-type Cpu []struct {
+type Cpu []Datapoint
+
+type Datapoint struct {
 	Timestamp  int64   `json:"timestamp"`
 	UserID     string  `json:"userId,omitempty"`
 	InstanceID string  `json:"instanceId"`
@@ -27,17 +59,43 @@ type Cpu []struct {
 	Minimum    float64 `json:"Minimum"`
 	State      string  `json:"state"`
 	Diskname   string  `json:"diskname"`
+	Process    string  `json:"processName"`
+	Command    string  `json:"command"`
+	GPUID      string  `json:"gpuId"`
+	DiskID     string  `json:"diskId"`
+
+	// InstanceType and GPUModel are not reported by CMS, they are filled in
+	// from DescribeInstances.
+	InstanceType string `json:"-"`
+	GPUModel     string `json:"-"`
 }
 
+var metricLabels = map[string][]string{}
+
 func newECSMetric(metricName string, docString string, labels []string) *prometheus.Desc {
+	metricLabels[metricName] = labels
 	return prometheus.NewDesc(
 		prometheus.BuildFQName("aliyun", "ecs", metricName),
 		docString, labels, nil,
 	)
 }
 
+// newHypervisorMetric describes a basic monitoring metric that CMS collects
+// from the hypervisor, so it is reported for every instance whether or not the
+// CloudMonitor agent is installed.
+func newHypervisorMetric(metricName string, docString string) *prometheus.Desc {
+	return newECSMetric(metricName, docString, []string{"id"})
+}
+
 func newExporter() *Exporter {
 	return &Exporter{
+		agentRunning:    newECSMetric("monitor_agent_running", "Whether the CloudMonitor agent is running on the instance.", []string{"id", "version"}),
+		diskInfo:        newECSMetric("cloud_disk_info", "Cloud disk category, performance level and attachment, always 1.", []string{"diskId", "id", "category", "performance_level", "type", "device"}),
+		diskSize:        newECSMetric("cloud_disk_size_bytes", "Provisioned size of the cloud disk in bytes.", diskLabels),
+		inventoryMetric: newInventoryMetrics(),
+		scheduledEvent:  newECSMetric("scheduled_event", "Planned execution time of a pending system event.", []string{"id", "event_type", "event_status"}),
+		lastSnapshot:    newECSMetric("last_snapshot_timestamp_seconds", "Creation time of the newest completed snapshot of the disk.", []string{"disk_id", "instance_id"}),
+		snapshotPolicy:  newECSMetric("auto_snapshot_policy_attached", "Whether an automatic snapshot policy in effect is applied to the disk.", []string{"disk_id", "instance_id"}),
 		newStatusMetric: map[string]*prometheus.Desc{
 			"cpu_total":                 newECSMetric("cpu_total", "cpu_total", []string{"id"}),
 			"cpu_idle":                  newECSMetric("cpu_idle", "cpu_idle", []string{"id"}),
@@ -73,6 +131,17 @@ func newExporter() *Exporter {
 			"networkout_packages_total": newECSMetric("networkout_packages_total", "networkout_packages_total", []string{"id", "device", "interface"}),
 			"networkout_rate":           newECSMetric("networkout_rate", "networkout_rate", []string{"id", "device", "interface"}),
 			"process_number":            newECSMetric("process_number", "process_number", []string{"id"}),
+
+			"CPUUtilization":          newHypervisorMetric("CPUUtilization", "CPU utilization of the instance in percent."),
+			"InternetInRate":          newHypervisorMetric("InternetInRate", "Inbound internet traffic of the instance in bits per second."),
+			"InternetOutRate":         newHypervisorMetric("InternetOutRate", "Outbound internet traffic of the instance in bits per second."),
+			"InternetOutRate_Percent": newHypervisorMetric("InternetOutRate_Percent", "Outbound internet bandwidth utilization of the instance in percent."),
+			"IntranetInRate":          newHypervisorMetric("IntranetInRate", "Inbound intranet traffic of the instance in bits per second."),
+			"IntranetOutRate":         newHypervisorMetric("IntranetOutRate", "Outbound intranet traffic of the instance in bits per second."),
+			"DiskReadBPS":             newHypervisorMetric("DiskReadBPS", "Bytes read per second from all disks of the instance."),
+			"DiskWriteBPS":            newHypervisorMetric("DiskWriteBPS", "Bytes written per second to all disks of the instance."),
+			"DiskReadIOPS":            newHypervisorMetric("DiskReadIOPS", "Read operations per second on all disks of the instance."),
+			"DiskWriteIOPS":           newHypervisorMetric("DiskWriteIOPS", "Write operations per second on all disks of the instance."),
 		},
 	}
 }
@@ -81,56 +150,252 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	for _, m := range e.newStatusMetric {
 		ch <- m
 	}
+	for _, aggregations := range e.aggregations {
+		for _, a := range aggregations {
+			ch <- a.Desc
+		}
+	}
+	if e.agentStatus {
+		ch <- e.agentRunning
+	}
+	if e.disks {
+		ch <- e.diskInfo
+		ch <- e.diskSize
+	}
+	if e.inventory {
+		for _, m := range e.inventoryMetric {
+			ch <- m
+		}
+	}
+	if e.events {
+		ch <- e.scheduledEvent
+	}
+	if e.snapshots {
+		ch <- e.lastSnapshot
+		ch <- e.snapshotPolicy
+	}
+	e.limiter.Describe(ch)
+	e.cache.Describe(ch)
 }
 
 func (e Exporter) Collect(ch chan<- prometheus.Metric) {
-	for metric, desc := range e.newStatusMetric {
-		request := cms.CreateDescribeMetricLastRequest()
-		request.Scheme = "https"
-		request.MetricName = metric
-		request.Namespace = "acs_ecs_dashboard"
-		request.AcceptFormat = "json"
-		client, _ := cms.NewClientWithAccessKey("cn-hangzhou", "secretid", "secretkey")
-		response, err := client.DescribeMetricLast(request)
+	metrics := make([]string, 0, len(e.newStatusMetric))
+	for metric := range e.newStatusMetric {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	var instances []ecs.Instance
+	if e.agentStatus || e.inventory || e.cpuCredits || e.gpu {
+		instances = listInstances()
+	}
+	byID := instancesByID(instances)
+	var disks []ecs.Disk
+	diskInstances := map[string]string{}
+	if e.disks || e.snapshots {
+		disks = listDisks()
+		for _, disk := range disks {
+			diskInstances[disk.DiskId] = disk.InstanceId
+		}
+	}
+
+	emitted := 0
+	for _, metric := range metrics {
+		cmsNamespace, cmsMetric := namespace, metric
+		if name, ok := diskMetricNames[metric]; ok {
+			cmsNamespace, cmsMetric = blockStorageNamespace, name
+		}
+		datapoints, err := e.cache.Get(cmsNamespace, cmsMetric, e.fetch)
 		if err != nil {
 			continue
 		}
 		var user Cpu
-		json.Unmarshal([]byte(string(response.Datapoints)), &user)
+		json.Unmarshal([]byte(datapoints), &user)
+		var samples, totals []cmsutil.Sample
 		for _, value := range user {
-			if metric == "cpu_total" || metric == "cpu_idle" || metric == "cpu_other" || metric == "cpu_system" || metric == "cpu_user" || metric == "cpu_wait" || metric == "load_15m" || metric == "load_1m" || metric == "load_5m" || metric == "memory_freespace" || metric == "memory_freeutilization" || metric == "memory_totalspace" || metric == "memory_usedspace" || metric == "memory_usedutilization" {
-				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value.Average, value.InstanceID)
-			} else if metric == "net_tcpconnection" {
-				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value.Average, value.InstanceID, value.State)
-			} else if metric == "networkin_errorpackages" || metric == "networkout_errorpackages" {
-				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value.Average, value.InstanceID, value.Device)
-			} else if metric == "networkin_packages" || metric == "networkout_packages" || metric == "networkin_rate" || metric == "networkout_rate" {
-				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value.Average, value.InstanceID, value.Device, value.IP)
-				if metric == "networkin_packages" {
-					ch <- prometheus.MustNewConstMetric(e.newStatusMetric["networkin_packages_total"], prometheus.GaugeValue, value.Sum, value.InstanceID, value.Device, value.IP)
-				} else if metric == "networkout_packages" {
-					ch <- prometheus.MustNewConstMetric(e.newStatusMetric["networkout_packages_total"], prometheus.GaugeValue, value.Sum, value.InstanceID, value.Device, value.IP)
-				}
-			} else if metric == "fs_inodeutilization" {
-				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value.Average, value.InstanceID, value.Device, value.Diskname, value.Hostname)
-			} else if metric == "diskusage_free" || metric == "diskusage_avail" || metric == "diskusage_total" || metric == "diskusage_used" || metric == "diskusage_utilization" {
-				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value.Average, value.InstanceID, value.Device, value.Diskname, value.Hostname)
-			} else if metric == "disk_readbytes" || metric == "disk_writebytes" || metric == "disk_readiops" || metric == "disk_writeiops" {
-				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value.Average, value.InstanceID, value.Device)
+			if cmsNamespace == blockStorageNamespace {
+				value.InstanceID = diskInstances[value.DiskID]
+			}
+			value.InstanceType = byID[value.InstanceID].InstanceType
+			value.GPUModel = byID[value.InstanceID].GPUSpec
+			labels := labelValues(metric, value)
+			if labels == nil || (strings.HasPrefix(metric, "process.") && !e.processes[value.Process]) {
+				continue
 			}
+			samples = append(samples, cmsutil.Sample{Labels: labels, Value: value.Average})
+			if metric == "networkin_packages" || metric == "networkout_packages" {
+				totals = append(totals, cmsutil.Sample{Labels: labels, Value: value.Sum})
+			}
+		}
+		e.export(ch, metric, samples, &emitted)
+		if len(totals) > 0 {
+			e.export(ch, metric+"_total", totals, &emitted)
 		}
 	}
+	if e.agentStatus {
+		e.collectAgentStatus(ch, instances)
+	}
+	if e.disks {
+		e.collectDisks(ch, disks)
+	}
+	if e.inventory {
+		e.collectInventory(ch, instances)
+	}
+	if e.events {
+		e.collectScheduledEvents(ch)
+	}
+	if e.snapshots {
+		e.collectSnapshots(ch, disks)
+	}
+	e.limiter.Collect(ch)
+	e.cache.Collect(ch)
+}
+
+func (e Exporter) fetch(namespace string, metric string) (string, error) {
+	client, _ := cms.NewClientWithAccessKey("cn-hangzhou", "secretid", "secretkey")
+	if top, ok := e.top[metric]; ok && namespace != blockStorageNamespace {
+		request := cms.CreateDescribeMetricTopRequest()
+		request.Scheme = "https"
+		request.MetricName = metric
+		request.Namespace = namespace
+		request.Orderby = top.orderBy
+		request.OrderDesc = "False" // False sorts descending
+		request.Length = strconv.Itoa(top.n)
+		request.AcceptFormat = "json"
+		response, err := client.DescribeMetricTop(request)
+		if err != nil {
+			return "", err
+		}
+		return response.Datapoints, nil
+	}
+	if e.lookback > 0 {
+		return cmsutil.DescribeMetricLatest(client, namespace, metric, e.lookback)
+	}
+	request := cms.CreateDescribeMetricLastRequest()
+	request.Scheme = "https"
+	request.MetricName = metric
+	request.Namespace = namespace
+	request.AcceptFormat = "json"
+	response, err := client.DescribeMetricLast(request)
+	if err != nil {
+		return "", err
+	}
+	return response.Datapoints, nil
+}
+
+func (e Exporter) export(ch chan<- prometheus.Metric, metric string, samples []cmsutil.Sample, emitted *int) {
+	for _, a := range e.aggregations[metric] {
+		for _, s := range e.limiter.Limit(a.Name, a.Apply(samples), emitted) {
+			ch <- prometheus.MustNewConstMetric(a.Desc, prometheus.GaugeValue, s.Value, s.Labels...)
+		}
+	}
+	if len(e.aggregations[metric]) > 0 && !e.keepRaw {
+		return
+	}
+	for _, s := range e.limiter.Limit(metric, samples, emitted) {
+		ch <- prometheus.MustNewConstMetric(e.newStatusMetric[metric], prometheus.GaugeValue, s.Value, s.Labels...)
+	}
+}
+
+func labelValues(metric string, value Datapoint) []string {
+	switch metric {
+	case "cpu_total", "cpu_idle", "cpu_other", "cpu_system", "cpu_user", "cpu_wait", "load_15m", "load_1m", "load_5m", "memory_freespace", "memory_freeutilization", "memory_totalspace", "memory_usedspace", "memory_usedutilization":
+		return []string{value.InstanceID}
+	case "CPUUtilization", "InternetInRate", "InternetOutRate", "InternetOutRate_Percent", "IntranetInRate", "IntranetOutRate", "DiskReadBPS", "DiskWriteBPS", "DiskReadIOPS", "DiskWriteIOPS":
+		return []string{value.InstanceID}
+	case "process.cpu", "process.memory", "process.openfile", "process.number":
+		return []string{value.InstanceID, value.Process, value.Command}
+	case "CPUCreditBalance", "CPUCreditUsage", "CPUNotpaidSurplusCreditUsage":
+		return []string{value.InstanceID, value.InstanceType}
+	case "gpu_gpu_usedutilization", "gpu_memory_freespace", "gpu_memory_totalspace", "gpu_memory_usedspace", "gpu_memory_usedutilization", "gpu_gpu_temperature", "gpu_power_readings_power_draw", "gpu_encoder_utilization", "gpu_decoder_utilization":
+		return []string{value.InstanceID, value.GPUID, value.GPUModel}
+	case "cloud_disk_DiskReadBPS", "cloud_disk_DiskWriteBPS", "cloud_disk_DiskReadIOPS", "cloud_disk_DiskWriteIOPS", "cloud_disk_LatencyRead", "cloud_disk_LatencyWrite":
+		return []string{value.DiskID, value.InstanceID}
+	case "net_tcpconnection":
+		return []string{value.InstanceID, value.State}
+	case "networkin_errorpackages", "networkout_errorpackages":
+		return []string{value.InstanceID, value.Device}
+	case "networkin_packages", "networkout_packages", "networkin_rate", "networkout_rate":
+		return []string{value.InstanceID, value.Device, value.IP}
+	case "fs_inodeutilization", "diskusage_free", "diskusage_avail", "diskusage_total", "diskusage_used", "diskusage_utilization":
+		return []string{value.InstanceID, value.Device, value.Diskname, value.Hostname}
+	case "disk_readbytes", "disk_writebytes", "disk_readiops", "disk_writeiops":
+		return []string{value.InstanceID, value.Device}
+	}
+	return nil
 }
 
 var (
 	listenAddress   = flag.String("telemetry.address", ":8023", "Address on which to expose metrics.")
 	metricsEndpoint = flag.String("telemetry.endpoint", "/metrics", "Path under which to expose metrics.")
+	seriesLimit     = flag.Int("series.limit", 0, "Maximum number of series exported per scrape, 0 for no limit.")
+	metricLimits    = flag.String("series.metric-limit", "", "Comma separated per-metric series caps, e.g. diskusage_used=500,net_tcpconnection=200.")
+	metricTop       = flag.String("metric.top", "", "Comma separated metrics to fetch with DescribeMetricTop, e.g. diskusage_utilization=Maximum:50.")
+	aggregate       = flag.String("aggregate", "", "Comma separated aggregation rules, e.g. disk_readbytes=sum:id,diskusage_used=max:id+hostname.")
+	aggregateRaw    = flag.Bool("aggregate.keep-raw", false, "Export the raw series of aggregated metrics alongside the aggregates.")
+	staleGrace      = flag.Duration("metric.stale-grace", 0, "How long to keep serving the last successful datapoints of a metric while CMS errors, e.g. 10m.")
+	lookback        = flag.Duration("metric.lookback", 0, "Use DescribeMetricList over this window and export the latest datapoint of each series instead of DescribeMetricLast, e.g. 5m.")
+	agentStatus     = flag.Bool("collector.agent-status", false, "Export the CloudMonitor agent status of every instance via DescribeMonitoringAgentStatuses.")
+	processes       = flag.String("process.allowlist", "", "Comma separated process names to export per-process agent metrics for, e.g. java,nginx.")
+	disks           = flag.Bool("collector.disks", false, "Export per cloud disk block storage metrics with disk ids, categories and sizes from DescribeDisks.")
+	inventory       = flag.Bool("collector.inventory", false, "Export instance status, vCPUs, memory and subscription expiry via DescribeInstances.")
+	events          = flag.Bool("collector.events", false, "Export pending system events such as maintenance reboots via DescribeInstanceHistoryEvents.")
+	cpuCredits      = flag.Bool("collector.cpu-credits", false, "Export CPU credit metrics of burstable instances labelled with the instance type from DescribeInstances.")
+	snapshots       = flag.Bool("collector.snapshots", false, "Export the last snapshot time and automatic snapshot policy of every disk via DescribeSnapshots.")
+	snapshotsEvery  = flag.Duration("snapshots.interval", 30*time.Minute, "How often to list the snapshots of the region for -collector.snapshots, the last result is served in between.")
+	gpu             = flag.Bool("collector.gpu", false, "Export per-GPU agent metrics labelled with the GPU model from DescribeInstances.")
 	//insecure        = flag.Bool("insecure", true, "Ignore server certificate if using https")
 )
 
 func main() {
 	flag.Parse()
 	exporter := newExporter()
+	if *cpuCredits {
+		for metric, desc := range newCreditMetrics() {
+			exporter.newStatusMetric[metric] = desc
+		}
+	}
+	if *disks {
+		for metric, desc := range newDiskMetrics() {
+			exporter.newStatusMetric[metric] = desc
+		}
+	}
+	if *gpu {
+		for metric, desc := range newGPUMetrics() {
+			exporter.newStatusMetric[metric] = desc
+		}
+	}
+	exporter.processes = parseProcessAllowlist(*processes)
+	if len(exporter.processes) > 0 {
+		for metric, desc := range newProcessMetrics() {
+			exporter.newStatusMetric[metric] = desc
+		}
+	}
+	var err error
+	exporter.top, err = parseTopN(*metricTop, exporter.newStatusMetric)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exporter.aggregations, err = cmsutil.ParseAggregations(*aggregate, exporter.newStatusMetric, metricLabels, newECSMetric)
+	if err != nil {
+		log.Fatal(err)
+	}
+	limits, err := cmsutil.ParseMetricLimits(*metricLimits, exporter.newStatusMetric, exporter.aggregations)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exporter.limiter = cmsutil.NewSeriesLimiter(namespace, *seriesLimit, limits)
+	exporter.keepRaw = *aggregateRaw
+	exporter.lookback = *lookback
+	exporter.cache = cmsutil.NewStaleCache(*staleGrace)
+	exporter.agentStatus = *agentStatus
+	exporter.disks = *disks
+	exporter.inventory = *inventory
+	exporter.events = *events
+	exporter.cpuCredits = *cpuCredits
+	exporter.gpu = *gpu
+	exporter.snapshots = *snapshots
+	exporter.snapshotPoller = newSnapshotPoller(*snapshotsEvery)
 	prometheus.MustRegister(exporter)
 	prometheus.Unregister(prometheus.NewGoCollector())
 
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"time"
+)
+
+// describeScheduledEvents pages through DescribeInstanceHistoryEvents and
+// returns the system events that have not completed yet.
+func describeScheduledEvents(client *ecs.Client) ([]ecs.InstanceSystemEventType, error) {
+	var events []ecs.InstanceSystemEventType
+	request := ecs.CreateDescribeInstanceHistoryEventsRequest()
+	request.Scheme = "https"
+	request.InstanceEventCycleStatus = &[]string{"Scheduled", "Inquiring", "Executing"}
+	request.PageSize = requests.NewInteger(100)
+	for page := 1; ; page++ {
+		request.PageNumber = requests.NewInteger(page)
+		response, err := client.DescribeInstanceHistoryEvents(request)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, response.InstanceSystemEventSet.InstanceSystemEventType...)
+		if len(response.InstanceSystemEventSet.InstanceSystemEventType) == 0 || len(events) >= response.TotalCount {
+			return events, nil
+		}
+	}
+}
+
+// collectScheduledEvents exports the planned execution time of every pending
+// system event such as a maintenance reboot or redeployment. When an instance
+// has several events of the same type and status the earliest one is kept.
+func (e Exporter) collectScheduledEvents(ch chan<- prometheus.Metric) {
+	client, err := newECSClient()
+	if err != nil {
+		log.Printf("scheduled events: %v", err)
+		return
+	}
+	events, err := describeScheduledEvents(client)
+	if err != nil {
+		log.Printf("scheduled events: %v", err)
+		return
+	}
+	earliest := map[[3]string]time.Time{}
+	for _, event := range events {
+		notBefore, err := time.Parse(time.RFC3339, event.NotBefore)
+		if err != nil {
+			log.Printf("scheduled event %s: %v", event.EventId, err)
+			continue
+		}
+		key := [3]string{event.InstanceId, event.EventType.Name, event.EventCycleStatus.Name}
+		if t, ok := earliest[key]; !ok || notBefore.Before(t) {
+			earliest[key] = notBefore
+		}
+	}
+	for key, notBefore := range earliest {
+		ch <- prometheus.MustNewConstMetric(e.scheduledEvent, prometheus.GaugeValue, float64(notBefore.Unix()), key[0], key[1], key[2])
+	}
+}
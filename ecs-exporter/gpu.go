@@ -0,0 +1,24 @@
+package main
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var gpuLabels = []string{"id", "gpuId", "gpu_model"}
+
+// newGPUMetric describes a per-GPU metric of the CloudMonitor agent.
+func newGPUMetric(metricName string, docString string) *prometheus.Desc {
+	return newECSMetric(metricName, docString, gpuLabels)
+}
+
+func newGPUMetrics() map[string]*prometheus.Desc {
+	return map[string]*prometheus.Desc{
+		"gpu_gpu_usedutilization":       newGPUMetric("gpu_gpu_usedutilization", "Utilization of the GPU in percent."),
+		"gpu_memory_freespace":          newGPUMetric("gpu_memory_freespace", "Free memory of the GPU in bytes."),
+		"gpu_memory_totalspace":         newGPUMetric("gpu_memory_totalspace", "Total memory of the GPU in bytes."),
+		"gpu_memory_usedspace":          newGPUMetric("gpu_memory_usedspace", "Used memory of the GPU in bytes."),
+		"gpu_memory_usedutilization":    newGPUMetric("gpu_memory_usedutilization", "Memory utilization of the GPU in percent."),
+		"gpu_gpu_temperature":           newGPUMetric("gpu_gpu_temperature", "Temperature of the GPU in degrees Celsius."),
+		"gpu_power_readings_power_draw": newGPUMetric("gpu_power_readings_power_draw", "Power draw of the GPU in watts."),
+		"gpu_encoder_utilization":       newGPUMetric("gpu_encoder_utilization", "Encoder utilization of the GPU in percent."),
+		"gpu_decoder_utilization":       newGPUMetric("gpu_decoder_utilization", "Decoder utilization of the GPU in percent."),
+	}
+}
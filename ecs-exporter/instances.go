@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"log"
+)
+
+func newECSClient() (*ecs.Client, error) {
+	return ecs.NewClientWithAccessKey("cn-hangzhou", "secretid", "secretkey")
+}
+
+// describeInstances pages through DescribeInstances and returns every
+// instance in the region.
+func describeInstances(client *ecs.Client) ([]ecs.Instance, error) {
+	var instances []ecs.Instance
+	request := ecs.CreateDescribeInstancesRequest()
+	request.Scheme = "https"
+	request.PageSize = requests.NewInteger(100)
+	for page := 1; ; page++ {
+		request.PageNumber = requests.NewInteger(page)
+		response, err := client.DescribeInstances(request)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, response.Instances.Instance...)
+		if len(response.Instances.Instance) == 0 || len(instances) >= response.TotalCount {
+			return instances, nil
+		}
+	}
+}
+
+// listInstances returns every instance in the region, or nil when they
+// cannot be described. Collect lists them once and shares them with the
+// collectors.
+func listInstances() []ecs.Instance {
+	client, err := newECSClient()
+	if err != nil {
+		log.Printf("instances: %v", err)
+		return nil
+	}
+	instances, err := describeInstances(client)
+	if err != nil {
+		log.Printf("instances: %v", err)
+		return nil
+	}
+	return instances
+}
+
+// instancesByID maps every instance id to its instance, for the metadata CMS
+// does not report such as the instance type and GPU model.
+func instancesByID(instances []ecs.Instance) map[string]ecs.Instance {
+	byID := map[string]ecs.Instance{}
+	for _, instance := range instances {
+		byID[instance.InstanceId] = instance
+	}
+	return byID
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"time"
+)
+
+var instanceStatuses = []string{"Pending", "Starting", "Running", "Stopping", "Stopped"}
+
+func newInventoryMetrics() map[string]*prometheus.Desc {
+	return map[string]*prometheus.Desc{
+		"instance_info":                     newECSMetric("instance_info", "Instance type, zone and billing method, always 1.", []string{"id", "hostname", "instance_type", "zone", "charge_type"}),
+		"instance_status":                   newECSMetric("instance_status", "Whether the instance is in the status.", []string{"id", "status"}),
+		"instance_expiry_timestamp_seconds": newECSMetric("instance_expiry_timestamp_seconds", "Expiry time of a subscription instance.", []string{"id"}),
+		"instance_cpu_cores":                newECSMetric("instance_cpu_cores", "vCPUs of the instance.", []string{"id"}),
+		"instance_memory_bytes":             newECSMetric("instance_memory_bytes", "Memory of the instance in bytes.", []string{"id"}),
+	}
+}
+
+// collectInventory exports the status, capacity and subscription expiry of
+// every instance.
+func (e Exporter) collectInventory(ch chan<- prometheus.Metric, instances []ecs.Instance) {
+	gauge := func(name string, value float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(e.inventoryMetric[name], prometheus.GaugeValue, value, labels...)
+	}
+	for _, instance := range instances {
+		id := instance.InstanceId
+		gauge("instance_info", 1, id, instance.HostName, instance.InstanceType, instance.ZoneId, instance.InstanceChargeType)
+		for _, status := range instanceStatuses {
+			var current float64
+			if instance.Status == status {
+				current = 1
+			}
+			gauge("instance_status", current, id, status)
+		}
+		gauge("instance_cpu_cores", float64(instance.Cpu), id)
+		gauge("instance_memory_bytes", float64(instance.Memory)*1024*1024, id)
+		if instance.InstanceChargeType == "PrePaid" {
+			expiry, err := time.Parse("2006-01-02T15:04Z", instance.ExpiredTime)
+			if err != nil {
+				log.Printf("inventory %s: %v", id, err)
+				continue
+			}
+			gauge("instance_expiry_timestamp_seconds", float64(expiry.Unix()), id)
+		}
+	}
+}
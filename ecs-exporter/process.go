@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"strings"
+)
+
+var processLabels = []string{"id", "processName", "command"}
+
+// newProcessMetric describes a per-process metric of the CloudMonitor agent.
+// CMS names these process.cpu and so on, which is not a valid Prometheus
+// name, so the exported name is given separately.
+func newProcessMetric(cmsName string, metricName string, docString string) *prometheus.Desc {
+	metricLabels[cmsName] = processLabels
+	return newECSMetric(metricName, docString, processLabels)
+}
+
+func newProcessMetrics() map[string]*prometheus.Desc {
+	return map[string]*prometheus.Desc{
+		"process.cpu":      newProcessMetric("process.cpu", "process_cpu", "CPU utilization of the process in percent."),
+		"process.memory":   newProcessMetric("process.memory", "process_memory", "Memory utilization of the process in percent."),
+		"process.openfile": newProcessMetric("process.openfile", "process_openfile", "Files opened by the process."),
+		"process.number":   newProcessMetric("process.number", "process_count", "Processes running with the process name."),
+	}
+}
+
+// parseProcessAllowlist parses a comma separated list of process names.
+func parseProcessAllowlist(s string) map[string]bool {
+	processes := map[string]bool{}
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			processes[name] = true
+		}
+	}
+	return processes
+}
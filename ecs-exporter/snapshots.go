@@ -0,0 +1,141 @@
+package main
+
+import (
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"sync"
+	"time"
+)
+
+// lastSnapshots pages through the completed snapshots of the region and
+// returns the creation time of the newest snapshot of every disk.
+func lastSnapshots(client *ecs.Client) (map[string]time.Time, error) {
+	last := map[string]time.Time{}
+	request := ecs.CreateDescribeSnapshotsRequest()
+	request.Scheme = "https"
+	request.Status = "accomplished"
+	request.PageSize = requests.NewInteger(100)
+	seen := 0
+	for page := 1; ; page++ {
+		request.PageNumber = requests.NewInteger(page)
+		response, err := client.DescribeSnapshots(request)
+		if err != nil {
+			return nil, err
+		}
+		for _, snapshot := range response.Snapshots.Snapshot {
+			created, err := time.Parse(time.RFC3339, snapshot.CreationTime)
+			if err != nil {
+				continue
+			}
+			if created.After(last[snapshot.SourceDiskId]) {
+				last[snapshot.SourceDiskId] = created
+			}
+		}
+		seen += len(response.Snapshots.Snapshot)
+		if len(response.Snapshots.Snapshot) == 0 || seen >= response.TotalCount {
+			return last, nil
+		}
+	}
+}
+
+// activeSnapshotPolicies returns the ids of the automatic snapshot policies
+// that are in effect.
+func activeSnapshotPolicies(client *ecs.Client) (map[string]bool, error) {
+	active := map[string]bool{}
+	request := ecs.CreateDescribeAutoSnapshotPolicyExRequest()
+	request.Scheme = "https"
+	request.PageSize = requests.NewInteger(100)
+	seen := 0
+	for page := 1; ; page++ {
+		request.PageNumber = requests.NewInteger(page)
+		response, err := client.DescribeAutoSnapshotPolicyEx(request)
+		if err != nil {
+			return nil, err
+		}
+		for _, policy := range response.AutoSnapshotPolicies.AutoSnapshotPolicy {
+			active[policy.AutoSnapshotPolicyId] = policy.Status == "Normal"
+		}
+		seen += len(response.AutoSnapshotPolicies.AutoSnapshotPolicy)
+		if len(response.AutoSnapshotPolicies.AutoSnapshotPolicy) == 0 || seen >= response.TotalCount {
+			return active, nil
+		}
+	}
+}
+
+// snapshotPoller keeps the newest snapshot time of every disk and the
+// automatic snapshot policies in effect. Listing every snapshot of the region
+// takes many calls, so they are refreshed in the background at most once per
+// interval and the last successful result is served in between.
+type snapshotPoller struct {
+	interval time.Duration
+	mu       sync.Mutex
+	polling  bool
+	polled   time.Time
+	last     map[string]time.Time
+	policies map[string]bool
+}
+
+func newSnapshotPoller(interval time.Duration) *snapshotPoller {
+	return &snapshotPoller{interval: interval}
+}
+
+// get returns the result of the last successful poll, ok is false until there
+// is one, and starts a new poll once interval has passed since.
+func (p *snapshotPoller) get() (last map[string]time.Time, policies map[string]bool, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.polling && time.Since(p.polled) >= p.interval {
+		p.polling = true
+		go p.poll()
+	}
+	return p.last, p.policies, !p.polled.IsZero()
+}
+
+func (p *snapshotPoller) poll() {
+	last, policies, err := describeSnapshotState()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.polling = false
+	if err != nil {
+		log.Printf("snapshots: %v", err)
+		return
+	}
+	p.last, p.policies, p.polled = last, policies, time.Now()
+}
+
+func describeSnapshotState() (map[string]time.Time, map[string]bool, error) {
+	client, err := newECSClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	last, err := lastSnapshots(client)
+	if err != nil {
+		return nil, nil, err
+	}
+	policies, err := activeSnapshotPolicies(client)
+	if err != nil {
+		return nil, nil, err
+	}
+	return last, policies, nil
+}
+
+// collectSnapshots exports when every disk was last snapshotted and whether
+// an automatic snapshot policy in effect is applied to it.
+func (e Exporter) collectSnapshots(ch chan<- prometheus.Metric, disks []ecs.Disk) {
+	last, policies, ok := e.snapshotPoller.get()
+	if !ok {
+		return
+	}
+	for _, disk := range disks {
+		if created, ok := last[disk.DiskId]; ok {
+			ch <- prometheus.MustNewConstMetric(e.lastSnapshot, prometheus.GaugeValue, float64(created.Unix()), disk.DiskId, disk.InstanceId)
+		}
+		var attached float64
+		if policies[disk.AutoSnapshotPolicyId] {
+			attached = 1
+		}
+		ch <- prometheus.MustNewConstMetric(e.snapshotPolicy, prometheus.GaugeValue, attached, disk.DiskId, disk.InstanceId)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+	"strings"
+)
+
+// topN selects the N series of a metric with the highest Average or Maximum
+// through DescribeMetricTop instead of exporting every series.
+type topN struct {
+	orderBy string
+	n       int
+}
+
+// parseTopN parses a list of metric=orderby:n entries such as
+// "diskusage_utilization=Maximum:50,networkin_rate=Average:20". Entries naming
+// a metric that is not exported are rejected.
+func parseTopN(s string, newStatusMetric map[string]*prometheus.Desc) (map[string]topN, error) {
+	tops := map[string]topN{}
+	if s == "" {
+		return tops, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid top-n %q, want metric=orderby:n", entry)
+		}
+		metric := strings.TrimSpace(kv[0])
+		if _, ok := newStatusMetric[metric]; !ok {
+			return nil, fmt.Errorf("invalid top-n %q, unknown metric %s", entry, metric)
+		}
+		spec := strings.SplitN(kv[1], ":", 2)
+		if len(spec) != 2 || (spec[0] != "Average" && spec[0] != "Maximum") {
+			return nil, fmt.Errorf("invalid top-n %q, orderby must be Average or Maximum", entry)
+		}
+		n, err := strconv.Atoi(spec[1])
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid top-n %q, n must be a positive number", entry)
+		}
+		tops[metric] = topN{orderBy: spec[0], n: n}
+	}
+	return tops, nil
+}
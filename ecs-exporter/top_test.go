@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTopN(t *testing.T) {
+	newStatusMetric := newExporter().newStatusMetric
+	tests := []struct {
+		in      string
+		want    map[string]topN
+		wantErr bool
+	}{
+		{"", map[string]topN{}, false},
+		{"diskusage_utilization=Maximum:50", map[string]topN{"diskusage_utilization": {"Maximum", 50}}, false},
+		{"diskusage_utilization=Maximum:50,networkin_rate=Average:20", map[string]topN{"diskusage_utilization": {"Maximum", 50}, "networkin_rate": {"Average", 20}}, false},
+		{"diskusage_utilization", nil, true},
+		{"diskusage_utilization=Maximum", nil, true},
+		{"diskusage_utilization=Sum:50", nil, true},
+		{"diskusage_utilization=Maximum:0", nil, true},
+		{"diskusage_utilization=Maximum:many", nil, true},
+		{"diskusage_utilisation=Maximum:50", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseTopN(tt.in, newStatusMetric)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseTopN(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTopN(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package cmsutil
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"regexp"
+	"strings"
+)
+
+var metricNameRE = regexp.MustCompile("^[a-zA-Z_:][a-zA-Z0-9_:]*$")
+
+// Aggregation folds the series of a metric into one series per distinct value
+// of the by labels, e.g. disk_readbytes summed over all devices of an instance.
+type Aggregation struct {
+	Name string
+	Desc *prometheus.Desc
+	op   string
+	by   []int
+}
+
+// ParseAggregations parses a list of metric=op:label+label rules such as
+// "disk_readbytes=sum:id,diskusage_used=max:id+hostname". Supported operations
+// are sum, avg, max and min. Rules naming the same aggregate twice, or
+// metrics whose CMS name is not a valid Prometheus name, are rejected.
+// metricLabels holds the label names of every metric and newDesc builds the
+// descriptor of an aggregate the way the exporter builds its own.
+func ParseAggregations(s string, newStatusMetric map[string]*prometheus.Desc, metricLabels map[string][]string, newDesc func(string, string, []string) *prometheus.Desc) (map[string][]Aggregation, error) {
+	aggregations := map[string][]Aggregation{}
+	names := map[string]bool{}
+	if s == "" {
+		return aggregations, nil
+	}
+	for _, rule := range strings.Split(s, ",") {
+		kv := strings.SplitN(rule, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid aggregation %q, want metric=op:label+label", rule)
+		}
+		metric := strings.TrimSpace(kv[0])
+		if _, ok := newStatusMetric[metric]; !ok {
+			return nil, fmt.Errorf("invalid aggregation %q, unknown metric %s", rule, metric)
+		}
+		spec := strings.SplitN(kv[1], ":", 2)
+		if len(spec) != 2 {
+			return nil, fmt.Errorf("invalid aggregation %q, want metric=op:label+label", rule)
+		}
+		op := spec[0]
+		if op != "sum" && op != "avg" && op != "max" && op != "min" {
+			return nil, fmt.Errorf("invalid aggregation %q, op must be sum, avg, max or min", rule)
+		}
+		labels := strings.Split(spec[1], "+")
+		by := make([]int, 0, len(labels))
+		for _, label := range labels {
+			i := indexOf(metricLabels[metric], label)
+			if i < 0 {
+				return nil, fmt.Errorf("invalid aggregation %q, %s has no label %s", rule, metric, label)
+			}
+			by = append(by, i)
+		}
+		name := metric + "_" + op
+		if !metricNameRE.MatchString(name) {
+			return nil, fmt.Errorf("invalid aggregation %q, %s is not a valid metric name", rule, name)
+		}
+		if names[name] || newStatusMetric[name] != nil {
+			return nil, fmt.Errorf("invalid aggregation %q, %s is already exported", rule, name)
+		}
+		names[name] = true
+		aggregations[metric] = append(aggregations[metric], Aggregation{
+			Name: name,
+			Desc: newDesc(name, fmt.Sprintf("%s of %s by %s", op, metric, strings.Join(labels, ",")), labels),
+			op:   op,
+			by:   by,
+		})
+	}
+	return aggregations, nil
+}
+
+// Apply returns the aggregated samples, one per distinct value of the by labels.
+func (a Aggregation) Apply(samples []Sample) []Sample {
+	var groups []Sample
+	counts := []int{}
+	index := map[string]int{}
+	for _, s := range samples {
+		labels := make([]string, len(a.by))
+		for i, j := range a.by {
+			labels[i] = s.Labels[j]
+		}
+		key := strings.Join(labels, "\xff")
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(groups)
+			groups = append(groups, Sample{labels, s.Value})
+			counts = append(counts, 1)
+			continue
+		}
+		counts[i]++
+		switch a.op {
+		case "sum", "avg":
+			groups[i].Value += s.Value
+		case "max":
+			if s.Value > groups[i].Value {
+				groups[i].Value = s.Value
+			}
+		case "min":
+			if s.Value < groups[i].Value {
+				groups[i].Value = s.Value
+			}
+		}
+	}
+	if a.op == "avg" {
+		for i := range groups {
+			groups[i].Value /= float64(counts[i])
+		}
+	}
+	return groups
+}
+
+func indexOf(labels []string, label string) int {
+	for i, l := range labels {
+		if l == label {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,85 @@
+package cmsutil
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"reflect"
+	"testing"
+)
+
+func TestParseAggregations(t *testing.T) {
+	newDesc := func(name string, help string, labels []string) *prometheus.Desc {
+		return prometheus.NewDesc(name, help, labels, nil)
+	}
+	metricLabels := map[string][]string{
+		"disk_readbytes": {"id", "device"},
+		"process.cpu":    {"id", "pid"},
+		"cpu_idle":       {"id"},
+		"cpu_idle_sum":   {"id"},
+	}
+	newStatusMetric := map[string]*prometheus.Desc{}
+	for metric, labels := range metricLabels {
+		newStatusMetric[metric] = newDesc(metric, metric, labels)
+	}
+	tests := []struct {
+		in      string
+		want    map[string][]string
+		wantErr bool
+	}{
+		{"", map[string][]string{}, false},
+		{"disk_readbytes=sum:id", map[string][]string{"disk_readbytes": {"disk_readbytes_sum"}}, false},
+		{"disk_readbytes=sum:id,disk_readbytes=max:id+device", map[string][]string{"disk_readbytes": {"disk_readbytes_sum", "disk_readbytes_max"}}, false},
+		{"disk_readbytes", nil, true},
+		{"disk_readbytes=sum", nil, true},
+		{"disk_readbytes=median:id", nil, true},
+		{"disk_readbytes=sum:hostname", nil, true},
+		{"unknown_metric=sum:id", nil, true},
+		{"disk_readbytes=sum:id,disk_readbytes=sum:id+device", nil, true},
+		{"process.cpu=sum:id", nil, true},
+		{"cpu_idle=sum:id", nil, true},
+	}
+	for _, tt := range tests {
+		aggregations, err := ParseAggregations(tt.in, newStatusMetric, metricLabels, newDesc)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAggregations(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		got := map[string][]string{}
+		for metric, rules := range aggregations {
+			for _, a := range rules {
+				got[metric] = append(got[metric], a.Name)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseAggregations(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAggregationApply(t *testing.T) {
+	samples := []Sample{
+		{[]string{"i-1", "vda"}, 1},
+		{[]string{"i-1", "vdb"}, 3},
+		{[]string{"i-2", "vda"}, 4},
+	}
+	tests := []struct {
+		op   string
+		by   []int
+		want []Sample
+	}{
+		{"sum", []int{0}, []Sample{{[]string{"i-1"}, 4}, {[]string{"i-2"}, 4}}},
+		{"avg", []int{0}, []Sample{{[]string{"i-1"}, 2}, {[]string{"i-2"}, 4}}},
+		{"max", []int{0}, []Sample{{[]string{"i-1"}, 3}, {[]string{"i-2"}, 4}}},
+		{"min", []int{0}, []Sample{{[]string{"i-1"}, 1}, {[]string{"i-2"}, 4}}},
+		{"sum", []int{1}, []Sample{{[]string{"vda"}, 5}, {[]string{"vdb"}, 3}}},
+		{"max", []int{1, 0}, []Sample{{[]string{"vda", "i-1"}, 1}, {[]string{"vdb", "i-1"}, 3}, {[]string{"vda", "i-2"}, 4}}},
+	}
+	for _, tt := range tests {
+		got := Aggregation{op: tt.op, by: tt.by}.Apply(samples)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s by %v = %v, want %v", tt.op, tt.by, got, tt.want)
+		}
+	}
+}
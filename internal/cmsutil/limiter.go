@@ -0,0 +1,108 @@
+package cmsutil
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sample is one series of a metric: its label values and its value.
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// SeriesLimiter caps the number of series exported per scrape, both for the
+// whole namespace and for individual metrics. Samples are sorted by their
+// label values before the cap is applied, so the same series survive on
+// every scrape.
+type SeriesLimiter struct {
+	namespace    string
+	maxSeries    int
+	metricLimits map[string]int
+	dropped      *prometheus.CounterVec
+}
+
+func NewSeriesLimiter(namespace string, limit int, metricLimits map[string]int) *SeriesLimiter {
+	return &SeriesLimiter{
+		namespace:    namespace,
+		maxSeries:    limit,
+		metricLimits: metricLimits,
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "aliyun",
+			Name:      "series_dropped_total",
+			Help:      "Number of series dropped because a series limit was exceeded.",
+		}, []string{"namespace", "metric"}),
+	}
+}
+
+// Limit returns the samples of metric that fit under the caps. emitted is the
+// number of series already exported in this scrape and is advanced by the
+// number of samples kept.
+func (l *SeriesLimiter) Limit(metric string, samples []Sample, emitted *int) []Sample {
+	sort.Slice(samples, func(i, j int) bool {
+		return strings.Join(samples[i].Labels, "\xff") < strings.Join(samples[j].Labels, "\xff")
+	})
+	keep := len(samples)
+	if n, ok := l.metricLimits[metric]; ok && keep > n {
+		keep = n
+	}
+	if l.maxSeries > 0 && *emitted+keep > l.maxSeries {
+		keep = l.maxSeries - *emitted
+		if keep < 0 {
+			keep = 0
+		}
+	}
+	if dropped := len(samples) - keep; dropped > 0 {
+		l.dropped.WithLabelValues(l.namespace, metric).Add(float64(dropped))
+		log.Printf("%s %s: dropped %d of %d series over the series limit", l.namespace, metric, dropped, len(samples))
+	}
+	*emitted += keep
+	return samples[:keep]
+}
+
+func (l *SeriesLimiter) Describe(ch chan<- *prometheus.Desc) {
+	l.dropped.Describe(ch)
+}
+
+func (l *SeriesLimiter) Collect(ch chan<- prometheus.Metric) {
+	l.dropped.Collect(ch)
+}
+
+// ParseMetricLimits parses a list of metric=limit pairs such as
+// "diskusage_used=500,net_tcpconnection=200". Pairs naming neither an exported
+// metric nor an aggregate are rejected.
+func ParseMetricLimits(s string, newStatusMetric map[string]*prometheus.Desc, aggregations map[string][]Aggregation) (map[string]int, error) {
+	names := map[string]bool{}
+	for metric := range newStatusMetric {
+		names[metric] = true
+	}
+	for _, rules := range aggregations {
+		for _, a := range rules {
+			names[a.Name] = true
+		}
+	}
+	limits := map[string]int{}
+	if s == "" {
+		return limits, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid series limit %q, want metric=limit", pair)
+		}
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid series limit %q, want metric=limit", pair)
+		}
+		metric := strings.TrimSpace(kv[0])
+		if !names[metric] {
+			return nil, fmt.Errorf("invalid series limit %q, unknown metric %s", pair, metric)
+		}
+		limits[metric] = n
+	}
+	return limits, nil
+}
@@ -0,0 +1,83 @@
+package cmsutil
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"reflect"
+	"testing"
+)
+
+func TestSeriesLimiterLimit(t *testing.T) {
+	samples := func(ids ...string) []Sample {
+		s := make([]Sample, 0, len(ids))
+		for _, id := range ids {
+			s = append(s, Sample{[]string{id}, 1})
+		}
+		return s
+	}
+	tests := []struct {
+		name         string
+		maxSeries    int
+		metricLimits map[string]int
+		emitted      int
+		samples      []Sample
+		want         []Sample
+		wantEmitted  int
+		wantDropped  float64
+	}{
+		{"no limits", 0, nil, 0, samples("b", "a"), samples("a", "b"), 2, 0},
+		{"metric limit keeps lowest labels", 0, map[string]int{"cpu_idle": 1}, 0, samples("b", "a"), samples("a"), 1, 1},
+		{"limit of other metric", 0, map[string]int{"cpu_user": 1}, 0, samples("b", "a"), samples("a", "b"), 2, 0},
+		{"series limit counts emitted", 3, nil, 2, samples("c", "b", "a"), samples("a"), 3, 2},
+		{"series limit exhausted", 3, nil, 4, samples("a"), samples(), 4, 1},
+		{"both limits", 3, map[string]int{"cpu_idle": 1}, 0, samples("b", "a"), samples("a"), 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewSeriesLimiter("acs_ecs_dashboard", tt.maxSeries, tt.metricLimits)
+			emitted := tt.emitted
+			got := l.Limit("cpu_idle", tt.samples, &emitted)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Limit() = %v, want %v", got, tt.want)
+			}
+			if emitted != tt.wantEmitted {
+				t.Errorf("emitted = %d, want %d", emitted, tt.wantEmitted)
+			}
+			if dropped := testutil.ToFloat64(l.dropped.WithLabelValues("acs_ecs_dashboard", "cpu_idle")); dropped != tt.wantDropped {
+				t.Errorf("dropped = %v, want %v", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestParseMetricLimits(t *testing.T) {
+	newStatusMetric := map[string]*prometheus.Desc{
+		"diskusage_used":    prometheus.NewDesc("diskusage_used", "", nil, nil),
+		"net_tcpconnection": prometheus.NewDesc("net_tcpconnection", "", nil, nil),
+	}
+	aggregations := map[string][]Aggregation{"diskusage_used": {{Name: "diskusage_used_max"}}}
+	tests := []struct {
+		in      string
+		want    map[string]int
+		wantErr bool
+	}{
+		{"", map[string]int{}, false},
+		{"diskusage_used=500", map[string]int{"diskusage_used": 500}, false},
+		{"diskusage_used=500, net_tcpconnection=0", map[string]int{"diskusage_used": 500, "net_tcpconnection": 0}, false},
+		{"diskusage_used", nil, true},
+		{"diskusage_used=many", nil, true},
+		{"diskusage_used=-1", nil, true},
+		{"diskusage_used_max=10", map[string]int{"diskusage_used_max": 10}, false},
+		{"diskusage_utilisation=10", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMetricLimits(tt.in, newStatusMetric, aggregations)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMetricLimits(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseMetricLimits(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package cmsutil
+
+import (
+	"encoding/json"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/cms"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DescribeMetricLatest queries DescribeMetricList over the lookback window and
+// returns, in the Datapoints format of DescribeMetricLast, the most recent
+// datapoint of every series. Unlike DescribeMetricLast it still finds a value
+// when the latest period has not been published yet.
+func DescribeMetricLatest(client *cms.Client, namespace string, metric string, lookback time.Duration) (string, error) {
+	end := time.Now()
+	request := cms.CreateDescribeMetricListRequest()
+	request.Scheme = "https"
+	request.MetricName = metric
+	request.Namespace = namespace
+	request.StartTime = strconv.FormatInt(end.Add(-lookback).UnixNano()/int64(time.Millisecond), 10)
+	request.EndTime = strconv.FormatInt(end.UnixNano()/int64(time.Millisecond), 10)
+	request.Length = "1000"
+	request.AcceptFormat = "json"
+
+	latest := map[string]map[string]interface{}{}
+	for {
+		response, err := client.DescribeMetricList(request)
+		if err != nil {
+			return "", err
+		}
+		var points []map[string]interface{}
+		json.Unmarshal([]byte(response.Datapoints), &points)
+		for _, point := range points {
+			key := seriesKey(point)
+			if old, ok := latest[key]; !ok || timestamp(point) >= timestamp(old) {
+				latest[key] = point
+			}
+		}
+		if response.NextToken == "" {
+			break
+		}
+		request.NextToken = response.NextToken
+	}
+
+	points := make([]map[string]interface{}, 0, len(latest))
+	for _, point := range latest {
+		points = append(points, point)
+	}
+	datapoints, err := json.Marshal(points)
+	if err != nil {
+		return "", err
+	}
+	return string(datapoints), nil
+}
+
+// seriesKey identifies the series of a datapoint by its dimensions, which are
+// the string valued fields; the timestamp and statistics are numbers.
+func seriesKey(point map[string]interface{}) string {
+	var dimensions []string
+	for k, v := range point {
+		if s, ok := v.(string); ok {
+			dimensions = append(dimensions, k+"="+s)
+		}
+	}
+	sort.Strings(dimensions)
+	return strings.Join(dimensions, ",")
+}
+
+func timestamp(point map[string]interface{}) float64 {
+	ts, _ := point["timestamp"].(float64)
+	return ts
+}
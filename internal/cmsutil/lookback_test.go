@@ -0,0 +1,31 @@
+package cmsutil
+
+import "testing"
+
+func TestSeriesKey(t *testing.T) {
+	tests := []struct {
+		a, b map[string]interface{}
+		same bool
+	}{
+		{
+			map[string]interface{}{"instanceId": "i-1", "device": "vda", "timestamp": 1.0, "Average": 2.0},
+			map[string]interface{}{"device": "vda", "instanceId": "i-1", "timestamp": 2.0, "Average": 5.0},
+			true,
+		},
+		{
+			map[string]interface{}{"instanceId": "i-1", "device": "vda"},
+			map[string]interface{}{"instanceId": "i-1", "device": "vdb"},
+			false,
+		},
+		{
+			map[string]interface{}{"instanceId": "i-1"},
+			map[string]interface{}{"instanceId": "i-1", "device": "vda"},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		if same := seriesKey(tt.a) == seriesKey(tt.b); same != tt.same {
+			t.Errorf("seriesKey(%v) == seriesKey(%v) is %v, want %v", tt.a, tt.b, same, tt.same)
+		}
+	}
+}
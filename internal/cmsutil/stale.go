@@ -0,0 +1,71 @@
+// Package cmsutil holds the CMS helpers shared by the exporters: the stale
+// datapoint cache, the DescribeMetricList lookback, the series limiter and
+// the aggregation rules.
+package cmsutil
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"sync"
+	"time"
+)
+
+// StaleCache keeps the last successful datapoints of every metric so a failed
+// CMS call can be answered with them for up to grace, flagging the metric in
+// aliyun_metric_stale. Once grace has passed the metric is dropped.
+type StaleCache struct {
+	grace   time.Duration
+	mu      sync.Mutex
+	entries map[string]cachedDatapoints
+	stale   *prometheus.GaugeVec
+}
+
+type cachedDatapoints struct {
+	datapoints string
+	fetched    time.Time
+}
+
+func NewStaleCache(grace time.Duration) *StaleCache {
+	return &StaleCache{
+		grace:   grace,
+		entries: map[string]cachedDatapoints{},
+		stale: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "aliyun",
+			Name:      "metric_stale",
+			Help:      "Whether the metric is served from the last successful datapoints because CMS is unavailable.",
+		}, []string{"namespace", "metric"}),
+	}
+}
+
+// Get fetches the datapoints of metric in namespace, falling back to the cached
+// ones while within grace.
+func (c *StaleCache) Get(namespace string, metric string, fetch func(string, string) (string, error)) (string, error) {
+	datapoints, err := fetch(namespace, metric)
+	key := namespace + "/" + metric
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		if c.grace > 0 {
+			c.entries[key] = cachedDatapoints{datapoints, time.Now()}
+		}
+		c.stale.WithLabelValues(namespace, metric).Set(0)
+		return datapoints, nil
+	}
+	cached, ok := c.entries[key]
+	if !ok || time.Since(cached.fetched) > c.grace {
+		delete(c.entries, key)
+		c.stale.DeleteLabelValues(namespace, metric)
+		return "", err
+	}
+	log.Printf("%s %s: serving datapoints from %s: %v", namespace, metric, cached.fetched.Format(time.RFC3339), err)
+	c.stale.WithLabelValues(namespace, metric).Set(1)
+	return cached.datapoints, nil
+}
+
+func (c *StaleCache) Describe(ch chan<- *prometheus.Desc) {
+	c.stale.Describe(ch)
+}
+
+func (c *StaleCache) Collect(ch chan<- prometheus.Metric) {
+	c.stale.Collect(ch)
+}
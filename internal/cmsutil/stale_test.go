@@ -0,0 +1,52 @@
+package cmsutil
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"testing"
+	"time"
+)
+
+func TestStaleCacheGet(t *testing.T) {
+	ok := func(string, string) (string, error) { return "[1]", nil }
+	fail := func(string, string) (string, error) { return "", errors.New("throttled") }
+	tests := []struct {
+		name      string
+		grace     time.Duration
+		cached    time.Duration // age of a cached entry, 0 for none
+		fetch     func(string, string) (string, error)
+		want      string
+		wantErr   bool
+		wantStale float64
+	}{
+		{"fresh", time.Minute, 0, ok, "[1]", false, 0},
+		{"error without cache", time.Minute, 0, fail, "", true, 0},
+		{"error within grace", time.Minute, time.Second, fail, "[0]", false, 1},
+		{"error after grace", time.Minute, time.Hour, fail, "", true, 0},
+		{"error without grace", 0, time.Second, fail, "", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewStaleCache(tt.grace)
+			if tt.cached > 0 {
+				c.entries["acs_ecs_dashboard/cpu_idle"] = cachedDatapoints{"[0]", time.Now().Add(-tt.cached)}
+			}
+			got, err := c.Get("acs_ecs_dashboard", "cpu_idle", tt.fetch)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("Get() = %q, %v, want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+			if stale := testutil.ToFloat64(c.stale.WithLabelValues("acs_ecs_dashboard", "cpu_idle")); stale != tt.wantStale {
+				t.Errorf("stale = %v, want %v", stale, tt.wantStale)
+			}
+		})
+	}
+}
+
+func TestStaleCacheGetRefreshes(t *testing.T) {
+	c := NewStaleCache(time.Minute)
+	c.Get("acs_ecs_dashboard", "cpu_idle", func(string, string) (string, error) { return "[1]", nil })
+	got, err := c.Get("acs_ecs_dashboard", "cpu_idle", func(string, string) (string, error) { return "", errors.New("throttled") })
+	if err != nil || got != "[1]" {
+		t.Errorf("Get() = %q, %v, want the last successful datapoints", got, err)
+	}
+}
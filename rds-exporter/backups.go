@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/rds"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"time"
+)
+
+func newBackupMetrics() map[string]*prometheus.Desc {
+	return map[string]*prometheus.Desc{
+		"last_backup_timestamp_seconds": newECSMetric("last_backup_timestamp_seconds", "End time of the last successful backup within the retention period, 0 if there is none.", []string{"id"}),
+		"backups_successful":            newECSMetric("backups_successful", "Successful backups within the retention period.", []string{"id"}),
+		"last_backup_size_bytes":        newECSMetric("last_backup_size_bytes", "Size of the last successful backup.", []string{"id"}),
+		"backups_failed":                newECSMetric("backups_failed", "Failed backups within the retention period.", []string{"id"}),
+		"backup_retention_days":         newECSMetric("backup_retention_days", "Days data backups are retained for by the backup policy.", []string{"id"}),
+	}
+}
+
+// backupSummary is the outcome of the backups of an instance within a window.
+type backupSummary struct {
+	last       rds.Backup
+	ended      time.Time
+	successful int
+	failed     int
+}
+
+// summarizeBackups pages through DescribeBackups since start and returns the
+// last successful backup and the number of successful and failed ones.
+func summarizeBackups(client *rds.Client, id string, start time.Time) (backupSummary, error) {
+	var summary backupSummary
+	request := rds.CreateDescribeBackupsRequest()
+	request.Scheme = "https"
+	request.DBInstanceId = id
+	request.StartTime = start.UTC().Format("2006-01-02T15:04Z")
+	request.EndTime = time.Now().UTC().Format("2006-01-02T15:04Z")
+	request.PageSize = requests.NewInteger(100)
+	for page := 1; ; page++ {
+		request.PageNumber = requests.NewInteger(page)
+		response, err := client.DescribeBackups(request)
+		if err != nil {
+			return summary, err
+		}
+		for _, backup := range response.Items.Backup {
+			if backup.BackupStatus != "Success" {
+				summary.failed++
+				continue
+			}
+			summary.successful++
+			ended, err := time.Parse(time.RFC3339, backup.BackupEndTime)
+			if err != nil {
+				continue
+			}
+			if ended.After(summary.ended) {
+				summary.last, summary.ended = backup, ended
+			}
+		}
+		if len(response.Items.Backup) < 100 {
+			return summary, nil
+		}
+	}
+}
+
+// pollBackups returns the last successful backup, failed backups and backup
+// retention of every instance.
+func (e Exporter) pollBackups(instances []rds.DBInstance) ([]prometheus.Metric, error) {
+	client, err := newRDSClient()
+	if err != nil {
+		return nil, err
+	}
+	var metrics []prometheus.Metric
+	gauge := func(name string, value float64, labels ...string) {
+		metrics = append(metrics, prometheus.MustNewConstMetric(e.backupMetric[name], prometheus.GaugeValue, value, labels...))
+	}
+	failed := 0
+	for _, instance := range instances {
+		id := instance.DBInstanceId
+		request := rds.CreateDescribeBackupPolicyRequest()
+		request.Scheme = "https"
+		request.DBInstanceId = id
+		policy, err := client.DescribeBackupPolicy(request)
+		if err != nil {
+			log.Printf("backups %s: %v", id, err)
+			failed++
+			continue
+		}
+		gauge("backup_retention_days", float64(policy.BackupRetentionPeriod), id)
+		retention := policy.BackupRetentionPeriod
+		if retention < 1 {
+			retention = 1
+		}
+		summary, err := summarizeBackups(client, id, time.Now().AddDate(0, 0, -retention))
+		if err != nil {
+			log.Printf("backups %s: %v", id, err)
+			continue
+		}
+		gauge("backups_successful", float64(summary.successful), id)
+		gauge("backups_failed", float64(summary.failed), id)
+		// Without a successful backup the timestamp is 0 rather than
+		// missing, so the age alert fires instead of resolving.
+		if summary.ended.IsZero() {
+			gauge("last_backup_timestamp_seconds", 0, id)
+			continue
+		}
+		gauge("last_backup_timestamp_seconds", float64(summary.ended.Unix()), id)
+		gauge("last_backup_size_bytes", float64(summary.last.BackupSize), id)
+	}
+	if failed > 0 && failed == len(instances) {
+		return nil, fmt.Errorf("all %d instances failed", failed)
+	}
+	return metrics, nil
+}
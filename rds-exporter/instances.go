@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/rds"
+	"sync"
+)
+
+func newRDSClient() (*rds.Client, error) {
+	return rds.NewClientWithAccessKey("cn-hangzhou", "secretid", "secretkey")
+}
+
+// describeDBInstances pages through DescribeDBInstances and returns every
+// instance in the region.
+func describeDBInstances(client *rds.Client) ([]rds.DBInstance, error) {
+	var instances []rds.DBInstance
+	request := rds.CreateDescribeDBInstancesRequest()
+	request.Scheme = "https"
+	request.PageSize = requests.NewInteger(100)
+	for page := 1; ; page++ {
+		request.PageNumber = requests.NewInteger(page)
+		response, err := client.DescribeDBInstances(request)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, response.Items.DBInstance...)
+		if len(response.Items.DBInstance) == 0 || len(instances) >= response.TotalRecordCount {
+			return instances, nil
+		}
+	}
+}
+
+// listDBInstances returns every instance in the region. Collect lists them
+// once and shares them with the collectors.
+func listDBInstances() ([]rds.DBInstance, error) {
+	client, err := newRDSClient()
+	if err != nil {
+		return nil, err
+	}
+	return describeDBInstances(client)
+}
+
+// engineCache keeps the engine of every instance from the last successful
+// listing, so that a failed DescribeDBInstances does not relabel every series
+// with an empty engine.
+type engineCache struct {
+	mu   sync.Mutex
+	byID map[string]string
+}
+
+// engines returns the engine of every instance, from instances when they were
+// listed and from the last successful listing otherwise.
+func (c *engineCache) engines(instances []rds.DBInstance, listed bool) map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if listed {
+		c.byID = map[string]string{}
+		for _, instance := range instances {
+			c.byID[instance.DBInstanceId] = instance.Engine
+		}
+	}
+	return c.byID
+}
+
+func describeDBInstanceAttribute(client *rds.Client, id string) (rds.DBInstanceAttribute, error) {
+	request := rds.CreateDescribeDBInstanceAttributeRequest()
+	request.Scheme = "https"
+	request.DBInstanceId = id
+	response, err := client.DescribeDBInstanceAttribute(request)
+	if err != nil {
+		return rds.DBInstanceAttribute{}, err
+	}
+	if len(response.Items.DBInstanceAttribute) == 0 {
+		return rds.DBInstanceAttribute{}, fmt.Errorf("instance %s not found", id)
+	}
+	return response.Items.DBInstanceAttribute[0], nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/rds"
+	"reflect"
+	"testing"
+)
+
+func TestEngineCache(t *testing.T) {
+	listing := []rds.DBInstance{
+		{DBInstanceId: "rm-1", Engine: "MySQL"},
+		{DBInstanceId: "pgm-1", Engine: "PostgreSQL"},
+	}
+	tests := []struct {
+		name      string
+		instances []rds.DBInstance
+		listed    bool
+		want      map[string]string
+	}{
+		{"failure before any listing", nil, false, nil},
+		{"listed", listing, true, map[string]string{"rm-1": "MySQL", "pgm-1": "PostgreSQL"}},
+		{"failure keeps the last listing", nil, false, map[string]string{"rm-1": "MySQL", "pgm-1": "PostgreSQL"}},
+		{"instance removed", listing[:1], true, map[string]string{"rm-1": "MySQL"}},
+		{"empty listing", nil, true, map[string]string{}},
+	}
+	c := &engineCache{}
+	for _, tt := range tests {
+		got := c.engines(tt.instances, tt.listed)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: engines() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/rds"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"time"
+)
+
+func newInventoryMetrics() map[string]*prometheus.Desc {
+	return map[string]*prometheus.Desc{
+		"instance_info":                     newECSMetric("instance_info", "Instance class, engine version, storage type, zone and HA category, always 1.", []string{"id", "engine", "engine_version", "instance_class", "storage_type", "zone", "category"}),
+		"instance_storage_bytes":            newECSMetric("instance_storage_bytes", "Storage capacity of the instance in bytes.", []string{"id"}),
+		"instance_max_connections":          newECSMetric("instance_max_connections", "Maximum connections of the instance class.", []string{"id"}),
+		"instance_max_iops":                 newECSMetric("instance_max_iops", "Maximum IOPS of the instance class.", []string{"id"}),
+		"instance_expiry_timestamp_seconds": newECSMetric("instance_expiry_timestamp_seconds", "Expiry time of a subscription instance.", []string{"id"}),
+	}
+}
+
+// pollInventory returns the spec, storage capacity and subscription expiry of
+// every instance.
+func (e Exporter) pollInventory(instances []rds.DBInstance) ([]prometheus.Metric, error) {
+	client, err := newRDSClient()
+	if err != nil {
+		return nil, err
+	}
+	var metrics []prometheus.Metric
+	gauge := func(name string, value float64, labels ...string) {
+		metrics = append(metrics, prometheus.MustNewConstMetric(e.inventoryMetric[name], prometheus.GaugeValue, value, labels...))
+	}
+	failed := 0
+	for _, instance := range instances {
+		id := instance.DBInstanceId
+		attribute, err := describeDBInstanceAttribute(client, id)
+		if err != nil {
+			log.Printf("inventory %s: %v", id, err)
+			failed++
+			continue
+		}
+		gauge("instance_info", 1, id, attribute.Engine, attribute.EngineVersion, attribute.DBInstanceClass, attribute.DBInstanceStorageType, attribute.ZoneId, attribute.Category)
+		gauge("instance_storage_bytes", float64(attribute.DBInstanceStorage)*1024*1024*1024, id)
+		gauge("instance_max_connections", float64(attribute.MaxConnections), id)
+		gauge("instance_max_iops", float64(attribute.MaxIOPS), id)
+		if attribute.PayType == "Prepaid" {
+			expiry, err := time.Parse(time.RFC3339, attribute.ExpireTime)
+			if err != nil {
+				log.Printf("inventory %s: %v", id, err)
+				continue
+			}
+			gauge("instance_expiry_timestamp_seconds", float64(expiry.Unix()), id)
+		}
+	}
+	if failed > 0 && failed == len(instances) {
+		return nil, fmt.Errorf("all %d instances failed", failed)
+	}
+	return metrics, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/rds"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"sort"
+	"time"
+)
+
+// logPoller summarizes the slow and error logs of every instance since the
+// start of the UTC day. The logs are pulled in the background at most once per
+// interval and the metrics of the last successful poll are served in between.
+// Only the maxTemplates slowest SQL templates of an instance are exported.
+type logPoller struct {
+	*poller
+	maxTemplates int
+	metric       map[string]*prometheus.Desc
+}
+
+func newLogPoller(interval time.Duration, maxTemplates int) *logPoller {
+	p := &logPoller{
+		maxTemplates: maxTemplates,
+		metric: map[string]*prometheus.Desc{
+			"slow_queries_total":               newECSMetric("slow_queries_total", "Slow queries logged since the start of the UTC day.", []string{"id", "db_name"}),
+			"slow_query_max_execution_seconds": newECSMetric("slow_query_max_execution_seconds", "Longest execution time of the SQL template since the start of the UTC day.", []string{"id", "db_name", "sql_hash"}),
+			"slow_query_avg_execution_seconds": newECSMetric("slow_query_avg_execution_seconds", "Average execution time of the SQL template since the start of the UTC day.", []string{"id", "db_name", "sql_hash"}),
+			"error_logs_total":                 newECSMetric("error_logs_total", "Error log entries since the start of the UTC day.", []string{"id"}),
+		},
+	}
+	p.poller = newPoller("logs", interval, p.poll)
+	return p
+}
+
+func (p *logPoller) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range p.metric {
+		ch <- m
+	}
+	p.describe(ch)
+}
+
+func (p *logPoller) poll(instances []rds.DBInstance) ([]prometheus.Metric, error) {
+	var metrics []prometheus.Metric
+	client, err := newRDSClient()
+	if err != nil {
+		return nil, err
+	}
+	gauge := func(name string, valueType prometheus.ValueType, value float64, labels ...string) {
+		metrics = append(metrics, prometheus.MustNewConstMetric(p.metric[name], valueType, value, labels...))
+	}
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	failed := 0
+	for _, instance := range instances {
+		id := instance.DBInstanceId
+		slowLogs, err := describeSlowLogs(client, id, day)
+		if err != nil {
+			log.Printf("logs %s: %v", id, err)
+			failed++
+			continue
+		}
+		queries := map[string]int64{}
+		for _, slowLog := range slowLogs {
+			queries[slowLog.DBName] += slowLog.MySQLTotalExecutionCounts + slowLog.SQLServerTotalExecutionCounts
+		}
+		for db, count := range queries {
+			gauge("slow_queries_total", prometheus.CounterValue, float64(count), id, db)
+		}
+		templates := mergeSlowLogs(slowLogs)
+		sort.Slice(templates, func(i, j int) bool {
+			return templates[i].max > templates[j].max
+		})
+		if len(templates) > p.maxTemplates {
+			templates = templates[:p.maxTemplates]
+		}
+		for _, t := range templates {
+			gauge("slow_query_max_execution_seconds", prometheus.GaugeValue, t.max, id, t.db, t.hash)
+			gauge("slow_query_avg_execution_seconds", prometheus.GaugeValue, t.avg, id, t.db, t.hash)
+		}
+		entries, err := countErrorLogs(client, id, day)
+		if err != nil {
+			log.Printf("logs %s: %v", id, err)
+			continue
+		}
+		gauge("error_logs_total", prometheus.CounterValue, float64(entries), id)
+	}
+	if failed > 0 && failed == len(instances) {
+		return nil, fmt.Errorf("all %d instances failed", failed)
+	}
+	return metrics, nil
+}
+
+// slowQuery is the slow log summary of one SQL template of a database.
+type slowQuery struct {
+	db   string
+	hash string
+	max  float64
+	avg  float64
+}
+
+// mergeSlowLogs folds the slow log rows into one slowQuery per database and SQL
+// template, so no series is exported twice. Rows without SQLHASH are keyed by
+// SQLIdStr; the average is weighted by the execution count of every row.
+func mergeSlowLogs(slowLogs []rds.SQLSlowLog) []slowQuery {
+	var templates []slowQuery
+	counts := []float64{}
+	index := map[string]int{}
+	for _, slowLog := range slowLogs {
+		hash := slowLog.SQLHASH
+		if hash == "" {
+			hash = slowLog.SQLIdStr
+		}
+		avg := slowLog.AvgExecutionTime
+		if slowLog.SQLServerAvgExecutionTime > 0 {
+			avg = slowLog.SQLServerAvgExecutionTime
+		}
+		count := float64(slowLog.MySQLTotalExecutionCounts + slowLog.SQLServerTotalExecutionCounts)
+		if count <= 0 {
+			count = 1
+		}
+		key := slowLog.DBName + "\xff" + hash
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(templates)
+			templates = append(templates, slowQuery{slowLog.DBName, hash, float64(slowLog.MaxExecutionTime), float64(avg)})
+			counts = append(counts, count)
+			continue
+		}
+		if float64(slowLog.MaxExecutionTime) > templates[i].max {
+			templates[i].max = float64(slowLog.MaxExecutionTime)
+		}
+		templates[i].avg = (templates[i].avg*counts[i] + float64(avg)*count) / (counts[i] + count)
+		counts[i] += count
+	}
+	return templates
+}
+
+// describeSlowLogs pages through the slow log summaries of the instance per
+// SQL template since day.
+func describeSlowLogs(client *rds.Client, id string, day time.Time) ([]rds.SQLSlowLog, error) {
+	var slowLogs []rds.SQLSlowLog
+	request := rds.CreateDescribeSlowLogsRequest()
+	request.Scheme = "https"
+	request.DBInstanceId = id
+	request.StartTime = day.Format("2006-01-02Z")
+	request.EndTime = day.Format("2006-01-02Z")
+	request.PageSize = requests.NewInteger(100)
+	for page := 1; ; page++ {
+		request.PageNumber = requests.NewInteger(page)
+		response, err := client.DescribeSlowLogs(request)
+		if err != nil {
+			return slowLogs, err
+		}
+		slowLogs = append(slowLogs, response.Items.SQLSlowLog...)
+		if len(response.Items.SQLSlowLog) == 0 || len(slowLogs) >= response.TotalRecordCount {
+			return slowLogs, nil
+		}
+	}
+}
+
+// countErrorLogs returns the number of error log entries of the instance since
+// day.
+func countErrorLogs(client *rds.Client, id string, day time.Time) (int, error) {
+	request := rds.CreateDescribeErrorLogsRequest()
+	request.Scheme = "https"
+	request.DBInstanceId = id
+	request.StartTime = day.Format("2006-01-02T15:04Z")
+	request.EndTime = time.Now().UTC().Format("2006-01-02T15:04Z")
+	request.PageSize = requests.NewInteger(30)
+	response, err := client.DescribeErrorLogs(request)
+	if err != nil {
+		return 0, err
+	}
+	return response.TotalRecordCount, nil
+}
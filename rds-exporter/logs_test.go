@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/rds"
+	"reflect"
+	"testing"
+)
+
+func TestMergeSlowLogs(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []rds.SQLSlowLog
+		want []slowQuery
+	}{
+		{"empty", nil, nil},
+		{
+			"distinct templates",
+			[]rds.SQLSlowLog{
+				{DBName: "shop", SQLHASH: "a", MaxExecutionTime: 3, AvgExecutionTime: 2, MySQLTotalExecutionCounts: 1},
+				{DBName: "shop", SQLHASH: "b", MaxExecutionTime: 5, AvgExecutionTime: 4, MySQLTotalExecutionCounts: 1},
+				{DBName: "blog", SQLHASH: "a", MaxExecutionTime: 1, AvgExecutionTime: 1, MySQLTotalExecutionCounts: 1},
+			},
+			[]slowQuery{{"shop", "a", 3, 2}, {"shop", "b", 5, 4}, {"blog", "a", 1, 1}},
+		},
+		{
+			"same template merged",
+			[]rds.SQLSlowLog{
+				{DBName: "shop", SQLHASH: "a", MaxExecutionTime: 3, AvgExecutionTime: 2, MySQLTotalExecutionCounts: 1},
+				{DBName: "shop", SQLHASH: "a", MaxExecutionTime: 9, AvgExecutionTime: 6, MySQLTotalExecutionCounts: 3},
+			},
+			[]slowQuery{{"shop", "a", 9, 5}},
+		},
+		{
+			"SQLIdStr without SQLHASH",
+			[]rds.SQLSlowLog{
+				{DBName: "shop", SQLIdStr: "1", MaxExecutionTime: 3, SQLServerAvgExecutionTime: 2, SQLServerTotalExecutionCounts: 1},
+				{DBName: "shop", SQLIdStr: "2", MaxExecutionTime: 4, SQLServerAvgExecutionTime: 3, SQLServerTotalExecutionCounts: 1},
+			},
+			[]slowQuery{{"shop", "1", 3, 2}, {"shop", "2", 4, 3}},
+		},
+		{
+			"no template id",
+			[]rds.SQLSlowLog{
+				{DBName: "shop", MaxExecutionTime: 3, AvgExecutionTime: 2},
+				{DBName: "shop", MaxExecutionTime: 1, AvgExecutionTime: 4},
+			},
+			[]slowQuery{{"shop", "", 3, 3}},
+		},
+	}
+	for _, tt := range tests {
+		if got := mergeSlowLogs(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: mergeSlowLogs() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
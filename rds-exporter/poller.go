@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/rds"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"sync"
+	"time"
+)
+
+// poller runs a collector whose per-instance API calls are too expensive for
+// every scrape. Collect hands it the instances it listed; once interval has
+// passed since the last successful poll a new one starts in the background,
+// and the metrics of the last successful poll are served in the meantime.
+type poller struct {
+	name     string
+	interval time.Duration
+	poll     func(instances []rds.DBInstance) ([]prometheus.Metric, error)
+	lastPoll *prometheus.Desc
+	mu       sync.Mutex
+	polling  bool
+	polled   time.Time
+	metrics  []prometheus.Metric
+}
+
+func newPoller(name string, interval time.Duration, poll func([]rds.DBInstance) ([]prometheus.Metric, error)) *poller {
+	return &poller{
+		name:     name,
+		interval: interval,
+		poll:     poll,
+		lastPoll: newECSMetric(name+"_last_poll_timestamp_seconds", "Time the "+name+" collector last polled successfully.", nil),
+	}
+}
+
+func (p *poller) describe(ch chan<- *prometheus.Desc) {
+	ch <- p.lastPoll
+}
+
+func (p *poller) collect(ch chan<- prometheus.Metric, instances []rds.DBInstance, listed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if listed && !p.polling && time.Since(p.polled) >= p.interval {
+		p.polling = true
+		go p.refresh(instances)
+	}
+	for _, m := range p.metrics {
+		ch <- m
+	}
+	if !p.polled.IsZero() {
+		ch <- prometheus.MustNewConstMetric(p.lastPoll, prometheus.GaugeValue, float64(p.polled.Unix()))
+	}
+}
+
+// refresh polls and keeps the result, unless the poll failed as a whole.
+func (p *poller) refresh(instances []rds.DBInstance) {
+	metrics, err := p.poll(instances)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.polling = false
+	if err != nil {
+		log.Printf("%s: %v", p.name, err)
+		return
+	}
+	p.metrics, p.polled = metrics, time.Now()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/rds"
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+	"time"
+)
+
+func testMetric(value float64) prometheus.Metric {
+	return prometheus.MustNewConstMetric(newECSMetric("test_value", "Test value.", nil), prometheus.GaugeValue, value)
+}
+
+func collected(p *poller, instances []rds.DBInstance, listed bool) int {
+	ch := make(chan prometheus.Metric, 10)
+	p.collect(ch, instances, listed)
+	close(ch)
+	return len(ch)
+}
+
+func TestPollerRefresh(t *testing.T) {
+	var err error
+	p := newPoller("test", time.Minute, func([]rds.DBInstance) ([]prometheus.Metric, error) {
+		if err != nil {
+			return nil, err
+		}
+		return []prometheus.Metric{testMetric(1)}, nil
+	})
+
+	p.polling = true
+	p.refresh(nil)
+	if p.polling || len(p.metrics) != 1 || p.polled.IsZero() {
+		t.Fatalf("after a successful poll: polling %v, %d metrics, polled %v", p.polling, len(p.metrics), p.polled)
+	}
+	polled := p.polled
+
+	err = errors.New("throttled")
+	p.polling = true
+	p.refresh(nil)
+	if p.polling || len(p.metrics) != 1 || p.polled != polled {
+		t.Errorf("after a failed poll: polling %v, %d metrics, polled %v, want the previous results from %v", p.polling, len(p.metrics), p.polled, polled)
+	}
+}
+
+func polling(p *poller) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.polling
+}
+
+func TestPollerCollect(t *testing.T) {
+	calls := make(chan []rds.DBInstance, 10)
+	release := make(chan bool)
+	p := newPoller("test", time.Minute, func(instances []rds.DBInstance) ([]prometheus.Metric, error) {
+		calls <- instances
+		<-release
+		return []prometheus.Metric{testMetric(1)}, nil
+	})
+	instances := []rds.DBInstance{{DBInstanceId: "rm-1"}}
+
+	if n := collected(p, instances, false); n != 0 || polling(p) {
+		t.Fatalf("unlisted instances: collected %d, polling %v, want no poll", n, polling(p))
+	}
+	if n := collected(p, instances, true); n != 0 || !polling(p) {
+		t.Fatalf("first scrape: collected %d, polling %v, want a poll started", n, polling(p))
+	}
+	if n := collected(p, instances, true); n != 0 {
+		t.Fatalf("scrape while polling: collected %d", n)
+	}
+	if got := <-calls; len(got) != 1 || got[0].DBInstanceId != "rm-1" {
+		t.Errorf("polled %v, want the listed instances", got)
+	}
+	close(release)
+	for deadline := time.Now().Add(time.Second); polling(p); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("poll did not finish")
+		}
+	}
+	// The metric and the last poll timestamp, without starting another
+	// poll within the interval.
+	if n := collected(p, instances, true); n != 2 || polling(p) {
+		t.Errorf("scrape after the poll: collected %d, polling %v, want 2 metrics and no poll", n, polling(p))
+	}
+	if len(calls) != 0 {
+		t.Errorf("polled %d more times, want once", len(calls))
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"aliyun-exporter/internal/cmsutil"
 	"encoding/json"
 	"flag"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/cms"
@@ -8,10 +9,24 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
+const namespace = "acs_rds_dashboard"
+
 type Exporter struct {
 	newStatusMetric map[string]*prometheus.Desc
+	replicaMetric   map[string]*prometheus.Desc
+	replicas        bool
+	inventoryMetric map[string]*prometheus.Desc
+	inventory       *poller
+	backupMetric    map[string]*prometheus.Desc
+	backups         *poller
+	logs            *logPoller
+	engines         *engineCache
+	lookback        time.Duration
+	cache           *cmsutil.StaleCache
 }
 
 type Cpu []struct {
@@ -36,39 +51,94 @@ func newECSMetric(metricName string, docString string, labels []string) *prometh
 	)
 }
 
+var rdsLabels = []string{"id", "engine"}
+
+// metricEngines lists the engines an engine specific metric is reported for,
+// by metric name prefix. Metrics without one of these prefixes, such as
+// CpuUsage, are reported for every engine.
+var metricEngines = map[string][]string{
+	"MySQL_":     {"MySQL", "MariaDB"},
+	"MariaDB_":   {"MariaDB"},
+	"SQLServer_": {"SQLServer"},
+	"PG_":        {"PostgreSQL"},
+}
+
+// appliesTo reports whether metric is collected for instances of engine. An
+// empty engine, of an instance that was never listed, matches every metric.
+func appliesTo(metric string, engine string) bool {
+	if engine == "" {
+		return true
+	}
+	for prefix, engines := range metricEngines {
+		if !strings.HasPrefix(metric, prefix) {
+			continue
+		}
+		for _, e := range engines {
+			if e == engine {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
 func newExporter() *Exporter {
 	return &Exporter{
 		newStatusMetric: map[string]*prometheus.Desc{
-			"ConnectionUsage":              newECSMetric("ConnectionUsage", "ConnectionUsage", []string{"id"}),
-			"CpuUsage":                     newECSMetric("CpuUsage", "CpuUsage", []string{"id"}),
-			"DiskUsage":                    newECSMetric("DiskUsage", "DiskUsage", []string{"id"}),
-			"IOPSUsage":                    newECSMetric("IOPSUsage", "IOPSUsage", []string{"id"}),
-			"MemoryUsage":                  newECSMetric("MemoryUsage", "MemoryUsage", []string{"id"}),
-			"MySQL_ActiveSessions":         newECSMetric("MySQL_ActiveSessions", "MySQL_ActiveSessions", []string{"id"}),
-			"MySQL_ComDelete":              newECSMetric("MySQL_ComDelete", "MySQL_ComDelete", []string{"id"}),
-			"MySQL_ComInsert":              newECSMetric("MySQL_ComInsert", "MySQL_ComInsert", []string{"id"}),
-			"MySQL_ComInsertSelect":        newECSMetric("MySQL_ComInsertSelect", "MySQL_ComInsertSelect", []string{"id"}),
-			"MySQL_ComReplace":             newECSMetric("MySQL_ComReplace", "MySQL_ComReplace", []string{"id"}),
-			"MySQL_ComReplaceSelect":       newECSMetric("MySQL_ComReplaceSelect", "MySQL_ComReplaceSelect", []string{"id"}),
-			"MySQL_ComSelect":              newECSMetric("MySQL_ComSelect", "MySQL_ComSelect", []string{"id"}),
-			"MySQL_ComUpdate":              newECSMetric("MySQL_ComUpdate", "MySQL_ComUpdate", []string{"id"}),
-			"MySQL_QPS":                    newECSMetric("MySQL_QPS", "MySQL_QPS", []string{"id"}),
-			"MySQL_TPS":                    newECSMetric("MySQL_TPS", "MySQL_TPS", []string{"id"}),
-			"MySQL_NetworkInNew":           newECSMetric("MySQL_NetworkInNew", "MySQL_NetworkInNew", []string{"id"}),
-			"MySQL_NetworkOutNew":          newECSMetric("MySQL_NetworkOutNew", "MySQL_NetworkOutNew", []string{"id"}),
-			"MySQL_IbufDirtyRatio":         newECSMetric("MySQL_IbufDirtyRatio", "MySQL_IbufDirtyRatio", []string{"id"}),
-			"MySQL_IbufUseRatio":           newECSMetric("MySQL_IbufUseRatio", "MySQL_IbufUseRatio", []string{"id"}),
-			"MySQL_InnoDBDataRead":         newECSMetric("MySQL_InnoDBDataRead", "MySQL_InnoDBDataRead", []string{"id"}),
-			"MySQL_InnoDBDataWritten":      newECSMetric("MySQL_InnoDBDataWritten", "MySQL_InnoDBDataWritten", []string{"id"}),
-			"MySQL_TempDiskTableCreates":   newECSMetric("MySQL_TempDiskTableCreates", "MySQL_TempDiskTableCreates", []string{"id"}),
-			"MySQL_InnoDBRowUpdate":        newECSMetric("MySQL_InnoDBRowUpdate", "MySQL_InnoDBRowUpdate", []string{"id"}),
-			"MySQL_InnoDBRowInsert":        newECSMetric("MySQL_InnoDBRowInsert", "MySQL_InnoDBRowInsert", []string{"id"}),
-			"MySQL_InnoDBRowDelete":        newECSMetric("MySQL_InnoDBRowDelete", "MySQL_InnoDBRowDelete", []string{"id"}),
-			"MySQL_InnoDBRowRead":          newECSMetric("MySQL_InnoDBRowRead", "MySQL_InnoDBRowRead", []string{"id"}),
-			"MySQL_InnoDBLogFsync":         newECSMetric("MySQL_InnoDBLogFsync", "MySQL_InnoDBLogFsync", []string{"id"}),
-			"MySQL_InnoDBLogWrites":        newECSMetric("MySQL_InnoDBLogWrites", "MySQL_InnoDBLogWrites", []string{"id"}),
-			"MySQL_InnoDBLogWriteRequests": newECSMetric("MySQL_InnoDBLogWriteRequests", "MySQL_InnoDBLogWriteRequests", []string{"id"}),
+			"ConnectionUsage":                 newECSMetric("ConnectionUsage", "ConnectionUsage", rdsLabels),
+			"CpuUsage":                        newECSMetric("CpuUsage", "CpuUsage", rdsLabels),
+			"DiskUsage":                       newECSMetric("DiskUsage", "DiskUsage", rdsLabels),
+			"IOPSUsage":                       newECSMetric("IOPSUsage", "IOPSUsage", rdsLabels),
+			"MemoryUsage":                     newECSMetric("MemoryUsage", "MemoryUsage", rdsLabels),
+			"MySQL_ActiveSessions":            newECSMetric("MySQL_ActiveSessions", "MySQL_ActiveSessions", rdsLabels),
+			"MySQL_ComDelete":                 newECSMetric("MySQL_ComDelete", "MySQL_ComDelete", rdsLabels),
+			"MySQL_ComInsert":                 newECSMetric("MySQL_ComInsert", "MySQL_ComInsert", rdsLabels),
+			"MySQL_ComInsertSelect":           newECSMetric("MySQL_ComInsertSelect", "MySQL_ComInsertSelect", rdsLabels),
+			"MySQL_ComReplace":                newECSMetric("MySQL_ComReplace", "MySQL_ComReplace", rdsLabels),
+			"MySQL_ComReplaceSelect":          newECSMetric("MySQL_ComReplaceSelect", "MySQL_ComReplaceSelect", rdsLabels),
+			"MySQL_ComSelect":                 newECSMetric("MySQL_ComSelect", "MySQL_ComSelect", rdsLabels),
+			"MySQL_ComUpdate":                 newECSMetric("MySQL_ComUpdate", "MySQL_ComUpdate", rdsLabels),
+			"MySQL_QPS":                       newECSMetric("MySQL_QPS", "MySQL_QPS", rdsLabels),
+			"MySQL_TPS":                       newECSMetric("MySQL_TPS", "MySQL_TPS", rdsLabels),
+			"MySQL_NetworkInNew":              newECSMetric("MySQL_NetworkInNew", "MySQL_NetworkInNew", rdsLabels),
+			"MySQL_NetworkOutNew":             newECSMetric("MySQL_NetworkOutNew", "MySQL_NetworkOutNew", rdsLabels),
+			"MySQL_IbufDirtyRatio":            newECSMetric("MySQL_IbufDirtyRatio", "MySQL_IbufDirtyRatio", rdsLabels),
+			"MySQL_IbufUseRatio":              newECSMetric("MySQL_IbufUseRatio", "MySQL_IbufUseRatio", rdsLabels),
+			"MySQL_InnoDBDataRead":            newECSMetric("MySQL_InnoDBDataRead", "MySQL_InnoDBDataRead", rdsLabels),
+			"MySQL_InnoDBDataWritten":         newECSMetric("MySQL_InnoDBDataWritten", "MySQL_InnoDBDataWritten", rdsLabels),
+			"MySQL_TempDiskTableCreates":      newECSMetric("MySQL_TempDiskTableCreates", "MySQL_TempDiskTableCreates", rdsLabels),
+			"MySQL_InnoDBRowUpdate":           newECSMetric("MySQL_InnoDBRowUpdate", "MySQL_InnoDBRowUpdate", rdsLabels),
+			"MySQL_InnoDBRowInsert":           newECSMetric("MySQL_InnoDBRowInsert", "MySQL_InnoDBRowInsert", rdsLabels),
+			"MySQL_InnoDBRowDelete":           newECSMetric("MySQL_InnoDBRowDelete", "MySQL_InnoDBRowDelete", rdsLabels),
+			"MySQL_InnoDBRowRead":             newECSMetric("MySQL_InnoDBRowRead", "MySQL_InnoDBRowRead", rdsLabels),
+			"MySQL_InnoDBLogFsync":            newECSMetric("MySQL_InnoDBLogFsync", "MySQL_InnoDBLogFsync", rdsLabels),
+			"MySQL_InnoDBLogWrites":           newECSMetric("MySQL_InnoDBLogWrites", "MySQL_InnoDBLogWrites", rdsLabels),
+			"MySQL_InnoDBLogWriteRequests":    newECSMetric("MySQL_InnoDBLogWriteRequests", "MySQL_InnoDBLogWriteRequests", rdsLabels),
+			"SQLServer_QPS":                   newECSMetric("SQLServer_QPS", "SQLServer_QPS", rdsLabels),
+			"SQLServer_TPS":                   newECSMetric("SQLServer_TPS", "SQLServer_TPS", rdsLabels),
+			"SQLServer_CacheHitRatio":         newECSMetric("SQLServer_CacheHitRatio", "SQLServer_CacheHitRatio", rdsLabels),
+			"SQLServer_NetworkInNew":          newECSMetric("SQLServer_NetworkInNew", "SQLServer_NetworkInNew", rdsLabels),
+			"SQLServer_NetworkOutNew":         newECSMetric("SQLServer_NetworkOutNew", "SQLServer_NetworkOutNew", rdsLabels),
+			"PG_ActiveConnections":            newECSMetric("PG_ActiveConnections", "PG_ActiveConnections", rdsLabels),
+			"PG_IdleConnections":              newECSMetric("PG_IdleConnections", "PG_IdleConnections", rdsLabels),
+			"PG_IdleInTransactionConnections": newECSMetric("PG_IdleInTransactionConnections", "PG_IdleInTransactionConnections", rdsLabels),
+			"PG_TPS":                          newECSMetric("PG_TPS", "PG_TPS", rdsLabels),
+			"PG_CacheHitRatio":                newECSMetric("PG_CacheHitRatio", "PG_CacheHitRatio", rdsLabels),
+			"PG_Deadlocks":                    newECSMetric("PG_Deadlocks", "PG_Deadlocks", rdsLabels),
+			"PG_TempBytes":                    newECSMetric("PG_TempBytes", "PG_TempBytes", rdsLabels),
+			"PG_NetworkInNew":                 newECSMetric("PG_NetworkInNew", "PG_NetworkInNew", rdsLabels),
+			"PG_NetworkOutNew":                newECSMetric("PG_NetworkOutNew", "PG_NetworkOutNew", rdsLabels),
+			"MariaDB_ActiveSessions":          newECSMetric("MariaDB_ActiveSessions", "MariaDB_ActiveSessions", rdsLabels),
+			"MariaDB_QPS":                     newECSMetric("MariaDB_QPS", "MariaDB_QPS", rdsLabels),
+			"MariaDB_TPS":                     newECSMetric("MariaDB_TPS", "MariaDB_TPS", rdsLabels),
+			"MariaDB_NetworkInNew":            newECSMetric("MariaDB_NetworkInNew", "MariaDB_NetworkInNew", rdsLabels),
+			"MariaDB_NetworkOutNew":           newECSMetric("MariaDB_NetworkOutNew", "MariaDB_NetworkOutNew", rdsLabels),
 		},
+		engines:         &engineCache{},
+		replicaMetric:   newReplicaMetrics(),
+		inventoryMetric: newInventoryMetrics(),
+		backupMetric:    newBackupMetrics(),
 	}
 }
 
@@ -76,37 +146,140 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	for _, m := range e.newStatusMetric {
 		ch <- m
 	}
+	if e.replicas {
+		for _, m := range e.replicaMetric {
+			ch <- m
+		}
+	}
+	if e.inventory != nil {
+		for _, m := range e.inventoryMetric {
+			ch <- m
+		}
+		e.inventory.describe(ch)
+	}
+	if e.backups != nil {
+		for _, m := range e.backupMetric {
+			ch <- m
+		}
+		e.backups.describe(ch)
+	}
+	if e.logs != nil {
+		e.logs.Describe(ch)
+	}
+	e.cache.Describe(ch)
 }
 
 func (e Exporter) Collect(ch chan<- prometheus.Metric) {
+	instances, err := listDBInstances()
+	if err != nil {
+		log.Printf("instances: %v", err)
+	}
+	listed := err == nil
+	engines := e.engines.engines(instances, listed)
+	running := map[string]bool{}
+	for _, engine := range engines {
+		running[engine] = true
+	}
 	for metric, desc := range e.newStatusMetric {
-		request := cms.CreateDescribeMetricLastRequest()
-		request.Scheme = "https"
-		request.MetricName = metric
-		request.Namespace = "acs_rds_dashboard"
-		request.AcceptFormat = "json"
-		client, _ := cms.NewClientWithAccessKey("cn-hangzhou", "secretid", "secretkey")
-		response, err := client.DescribeMetricLast(request)
+		if !anyApplies(metric, running) {
+			continue
+		}
+		datapoints, err := e.cache.Get(namespace, metric, e.fetch)
 		if err != nil {
 			continue
 		}
 		var user Cpu
-		json.Unmarshal([]byte(string(response.Datapoints)), &user)
+		json.Unmarshal([]byte(datapoints), &user)
 		for _, value := range user {
-			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value.Average, value.InstanceID)
+			engine := engines[value.InstanceID]
+			if !appliesTo(metric, engine) {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value.Average, value.InstanceID, engine)
+		}
+	}
+	if e.replicas && listed {
+		e.collectReplicas(ch, instances)
+	}
+	if e.inventory != nil {
+		e.inventory.collect(ch, instances, listed)
+	}
+	if e.backups != nil {
+		e.backups.collect(ch, instances, listed)
+	}
+	if e.logs != nil {
+		e.logs.collect(ch, instances, listed)
+	}
+	e.cache.Collect(ch)
+}
+
+// anyApplies reports whether metric is collected for any of the engines, so
+// that metrics of engines nobody runs are not fetched. Without any engine, as
+// before the first successful listing, every metric is fetched.
+func anyApplies(metric string, engines map[string]bool) bool {
+	if len(engines) == 0 {
+		return true
+	}
+	for engine := range engines {
+		if appliesTo(metric, engine) {
+			return true
 		}
 	}
+	return false
+}
+
+func (e Exporter) fetch(namespace string, metric string) (string, error) {
+	client, _ := cms.NewClientWithAccessKey("cn-hangzhou", "secretid", "secretkey")
+	if e.lookback > 0 {
+		return cmsutil.DescribeMetricLatest(client, namespace, metric, e.lookback)
+	}
+	request := cms.CreateDescribeMetricLastRequest()
+	request.Scheme = "https"
+	request.MetricName = metric
+	request.Namespace = namespace
+	request.AcceptFormat = "json"
+	response, err := client.DescribeMetricLast(request)
+	if err != nil {
+		return "", err
+	}
+	return response.Datapoints, nil
 }
 
 var (
 	listenAddress   = flag.String("telemetry.address", ":8024", "Address on which to expose metrics.")
 	metricsEndpoint = flag.String("telemetry.endpoint", "/metrics", "Path under which to expose metrics.")
+	staleGrace      = flag.Duration("metric.stale-grace", 0, "How long to keep serving the last successful datapoints of a metric while CMS errors, e.g. 10m.")
+	lookback        = flag.Duration("metric.lookback", 0, "Use DescribeMetricList over this window and export the latest datapoint of each series instead of DescribeMetricLast, e.g. 5m.")
+	replicas        = flag.Bool("collector.replicas", false, "Export the primary and role of every instance via DescribeDBInstances and the MySQL_ReplicationDelay CMS metric of read-only instances.")
+	inventory       = flag.Bool("collector.inventory", false, "Export instance class, engine version, storage capacity, max connections and IOPS and subscription expiry via DescribeDBInstanceAttribute.")
+	pollInterval    = flag.Duration("poll.interval", 10*time.Minute, "How often the inventory and backup collectors call their per-instance APIs, the last results are served in between.")
+	backups         = flag.Bool("collector.backups", false, "Export the last successful backup, failed backups and backup retention of every instance via DescribeBackups.")
+	logs            = flag.Bool("collector.logs", false, "Export slow query and error log statistics via DescribeSlowLogs and DescribeErrorLogs.")
+	logsInterval    = flag.Duration("logs.interval", 10*time.Minute, "How often to pull the slow and error logs, the last results are served in between.")
+	logsTemplates   = flag.Int("logs.max-templates", 20, "Maximum number of slowest SQL templates exported per instance.")
 	//insecure        = flag.Bool("insecure", true, "Ignore server certificate if using https")
 )
 
 func main() {
 	flag.Parse()
 	exporter := newExporter()
+	if *replicas {
+		for metric, desc := range newReplicationMetrics() {
+			exporter.newStatusMetric[metric] = desc
+		}
+	}
+	exporter.lookback = *lookback
+	exporter.cache = cmsutil.NewStaleCache(*staleGrace)
+	exporter.replicas = *replicas
+	if *inventory {
+		exporter.inventory = newPoller("inventory", *pollInterval, exporter.pollInventory)
+	}
+	if *backups {
+		exporter.backups = newPoller("backups", *pollInterval, exporter.pollBackups)
+	}
+	if *logs {
+		exporter.logs = newLogPoller(*logsInterval, *logsTemplates)
+	}
 	prometheus.MustRegister(exporter)
 	prometheus.Unregister(prometheus.NewGoCollector())
 
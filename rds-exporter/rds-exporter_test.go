@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestAppliesTo(t *testing.T) {
+	tests := []struct {
+		metric string
+		engine string
+		want   bool
+	}{
+		{"CpuUsage", "MySQL", true},
+		{"CpuUsage", "PPAS", true},
+		{"MySQL_QPS", "MySQL", true},
+		{"MySQL_QPS", "MariaDB", true},
+		{"MySQL_QPS", "PostgreSQL", false},
+		{"MySQL_QPS", "PPAS", false},
+		{"MariaDB_QPS", "MariaDB", true},
+		{"MariaDB_QPS", "MySQL", false},
+		{"SQLServer_QPS", "SQLServer", true},
+		{"SQLServer_QPS", "MySQL", false},
+		{"PG_TPS", "PostgreSQL", true},
+		{"PG_TPS", "PPAS", false},
+		// An instance missing from the engine cache has no engine.
+		{"MySQL_QPS", "", true},
+		{"PG_TPS", "", true},
+	}
+	for _, tt := range tests {
+		if got := appliesTo(tt.metric, tt.engine); got != tt.want {
+			t.Errorf("appliesTo(%q, %q) = %v, want %v", tt.metric, tt.engine, got, tt.want)
+		}
+	}
+}
+
+func TestAnyApplies(t *testing.T) {
+	tests := []struct {
+		metric  string
+		engines map[string]bool
+		want    bool
+	}{
+		{"MySQL_QPS", nil, true},
+		{"MySQL_QPS", map[string]bool{"MySQL": true}, true},
+		{"MySQL_QPS", map[string]bool{"MariaDB": true}, true},
+		{"MySQL_QPS", map[string]bool{"PostgreSQL": true, "SQLServer": true}, false},
+		{"MySQL_QPS", map[string]bool{"PPAS": true}, false},
+		{"CpuUsage", map[string]bool{"PPAS": true}, true},
+		{"PG_TPS", map[string]bool{"MySQL": true, "PostgreSQL": true}, true},
+		{"MariaDB_QPS", map[string]bool{"MySQL": true}, false},
+	}
+	for _, tt := range tests {
+		if got := anyApplies(tt.metric, tt.engines); got != tt.want {
+			t.Errorf("anyApplies(%q, %v) = %v, want %v", tt.metric, tt.engines, got, tt.want)
+		}
+	}
+}
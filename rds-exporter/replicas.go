@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/rds"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newReplicationMetrics() map[string]*prometheus.Desc {
+	return map[string]*prometheus.Desc{
+		"MySQL_ReplicationDelay": newECSMetric("MySQL_ReplicationDelay", "Replication delay of a read-only MySQL instance in seconds.", rdsLabels),
+	}
+}
+
+func newReplicaMetrics() map[string]*prometheus.Desc {
+	return map[string]*prometheus.Desc{
+		"replica_info": newECSMetric("replica_info", "Primary instance and role of the instance, always 1.", []string{"id", "primary_id", "role"}),
+	}
+}
+
+// primaryOf returns the primary of the instance, which is the instance itself
+// unless it is a read-only, guard or temporary instance.
+func primaryOf(instance rds.DBInstance) string {
+	if instance.MasterInstanceId != "" {
+		return instance.MasterInstanceId
+	}
+	return instance.DBInstanceId
+}
+
+// collectReplicas exports the primary and role of every instance. The
+// replication delay of read-only instances comes from the
+// MySQL_ReplicationDelay CMS metric.
+func (e Exporter) collectReplicas(ch chan<- prometheus.Metric, instances []rds.DBInstance) {
+	for _, instance := range instances {
+		ch <- prometheus.MustNewConstMetric(e.replicaMetric["replica_info"], prometheus.GaugeValue, 1, instance.DBInstanceId, primaryOf(instance), instance.DBInstanceType)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"aliyun-exporter/internal/cmsutil"
 	"encoding/json"
 	"flag"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/cms"
@@ -8,10 +9,15 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log"
 	"net/http"
+	"time"
 )
 
+const namespace = "acs_kvstore"
+
 type Exporter struct {
 	newStatusMetric map[string]*prometheus.Desc
+	lookback        time.Duration
+	cache           *cmsutil.StaleCache
 }
 
 type Cpu []struct {
@@ -52,37 +58,54 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	for _, m := range e.newStatusMetric {
 		ch <- m
 	}
+	e.cache.Describe(ch)
 }
 
 func (e Exporter) Collect(ch chan<- prometheus.Metric) {
 	for metric, desc := range e.newStatusMetric {
-		request := cms.CreateDescribeMetricLastRequest()
-		request.Scheme = "https"
-		request.MetricName = metric
-		request.Namespace = "acs_kvstore"
-		request.AcceptFormat = "json"
-		client, _ := cms.NewClientWithAccessKey("cn-hangzhou", "secretid", "secretkey")
-		response, err := client.DescribeMetricLast(request)
+		datapoints, err := e.cache.Get(namespace, metric, e.fetch)
 		if err != nil {
 			continue
 		}
 		var user Cpu
-		json.Unmarshal([]byte(string(response.Datapoints)), &user)
+		json.Unmarshal([]byte(datapoints), &user)
 		for _, value := range user {
 			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value.Average, value.InstanceID)
 		}
 	}
+	e.cache.Collect(ch)
+}
+
+func (e Exporter) fetch(namespace string, metric string) (string, error) {
+	client, _ := cms.NewClientWithAccessKey("cn-hangzhou", "secretid", "secretkey")
+	if e.lookback > 0 {
+		return cmsutil.DescribeMetricLatest(client, namespace, metric, e.lookback)
+	}
+	request := cms.CreateDescribeMetricLastRequest()
+	request.Scheme = "https"
+	request.MetricName = metric
+	request.Namespace = namespace
+	request.AcceptFormat = "json"
+	response, err := client.DescribeMetricLast(request)
+	if err != nil {
+		return "", err
+	}
+	return response.Datapoints, nil
 }
 
 var (
 	listenAddress   = flag.String("telemetry.address", ":8025", "Address on which to expose metrics.")
 	metricsEndpoint = flag.String("telemetry.endpoint", "/metrics", "Path under which to expose metrics.")
+	staleGrace      = flag.Duration("metric.stale-grace", 0, "How long to keep serving the last successful datapoints of a metric while CMS errors, e.g. 10m.")
+	lookback        = flag.Duration("metric.lookback", 0, "Use DescribeMetricList over this window and export the latest datapoint of each series instead of DescribeMetricLast, e.g. 5m.")
 	//insecure        = flag.Bool("insecure", true, "Ignore server certificate if using https")
 )
 
 func main() {
 	flag.Parse()
 	exporter := newExporter()
+	exporter.lookback = *lookback
+	exporter.cache = cmsutil.NewStaleCache(*staleGrace)
 	prometheus.MustRegister(exporter)
 	prometheus.Unregister(prometheus.NewGoCollector())
 
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/slb"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"strconv"
+)
+
+// collectCertificates exports the expiry time of every server certificate
+// bound to an HTTPS listener, including the certificates of its additional
+// domains.
+func (e Exporter) collectCertificates(ch chan<- prometheus.Metric, client *slb.Client, loadBalancers []loadBalancer) {
+	request := slb.CreateDescribeServerCertificatesRequest()
+	request.Scheme = "https"
+	response, err := client.DescribeServerCertificates(request)
+	if err != nil {
+		log.Printf("certificates: %v", err)
+		return
+	}
+	certificates := map[string]slb.ServerCertificate{}
+	for _, certificate := range response.ServerCertificates.ServerCertificate {
+		certificates[certificate.ServerCertificateId] = certificate
+	}
+
+	for _, lb := range loadBalancers {
+		if lb.attribute == nil {
+			continue
+		}
+		for _, listener := range lb.attribute.ListenerPortsAndProtocol.ListenerPortAndProtocol {
+			if listener.ListenerProtocol != "https" {
+				continue
+			}
+			request := slb.CreateDescribeLoadBalancerHTTPSListenerAttributeRequest()
+			request.Scheme = "https"
+			request.LoadBalancerId = lb.LoadBalancerId
+			request.ListenerPort = requests.NewInteger(listener.ListenerPort)
+			https, err := client.DescribeLoadBalancerHTTPSListenerAttribute(request)
+			if err != nil {
+				log.Printf("certificates %s:%d: %v", lb.LoadBalancerId, listener.ListenerPort, err)
+				continue
+			}
+			ids := []string{https.ServerCertificateId}
+			for _, domain := range https.DomainExtensions.DomainExtension {
+				ids = append(ids, domain.ServerCertificateId)
+			}
+			seen := map[string]bool{}
+			for _, id := range ids {
+				certificate, ok := certificates[id]
+				if !ok || seen[id] {
+					continue
+				}
+				seen[id] = true
+				ch <- prometheus.MustNewConstMetric(e.certificateExpiry, prometheus.GaugeValue, float64(certificate.ExpireTimeStamp)/1000,
+					lb.LoadBalancerId, strconv.Itoa(listener.ListenerPort), id, certificate.CommonName)
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/slb"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// collectBackendHealth exports the health check result of every backend server
+// behind every listener. Servers whose listener has health checks disabled are
+// reported as unavailable by SLB and skipped.
+func (e Exporter) collectBackendHealth(ch chan<- prometheus.Metric, client *slb.Client, loadBalancers []loadBalancer) {
+	for _, lb := range loadBalancers {
+		groups, err := backendVServerGroups(client, lb.LoadBalancerId)
+		if err != nil {
+			log.Printf("backend health %s: %v", lb.LoadBalancerId, err)
+		}
+		request := slb.CreateDescribeHealthStatusRequest()
+		request.Scheme = "https"
+		request.LoadBalancerId = lb.LoadBalancerId
+		response, err := client.DescribeHealthStatus(request)
+		if err != nil {
+			log.Printf("backend health %s: %v", lb.LoadBalancerId, err)
+			continue
+		}
+		// A server in several groups behind one listener is reported once
+		// per group but can't be told apart, the rows are merged and count
+		// as unhealthy if any of them is.
+		var keys []string
+		healthy := map[string]float64{}
+		labels := map[string][]string{}
+		for _, server := range response.BackendServers.BackendServer {
+			var value float64
+			switch server.ServerHealthStatus {
+			case "normal":
+				value = 1
+			case "abnormal":
+				value = 0
+			default:
+				continue
+			}
+			listener := listenerKey(server.ListenerPort, server.Protocol)
+			group := strings.Join(groups[backendKey(listener, server.ServerId, server.Port)], ",")
+			values := []string{lb.LoadBalancerId, strconv.Itoa(server.ListenerPort), server.Protocol, server.ServerId, server.ServerIp, strconv.Itoa(server.Port), group}
+			key := strings.Join(values, "\xff")
+			if old, ok := healthy[key]; ok {
+				if value < old {
+					healthy[key] = value
+				}
+				continue
+			}
+			keys = append(keys, key)
+			healthy[key], labels[key] = value, values
+		}
+		for _, key := range keys {
+			ch <- prometheus.MustNewConstMetric(e.backendServerHealthy, prometheus.GaugeValue, healthy[key], labels[key]...)
+		}
+	}
+}
+
+func listenerKey(port int, protocol string) string {
+	return strconv.Itoa(port) + "/" + strings.ToLower(protocol)
+}
+
+func backendKey(listener string, serverID string, port int) string {
+	return listener + "/" + serverID + ":" + strconv.Itoa(port)
+}
+
+// backendVServerGroups maps every backend server port behind every listener of
+// a load balancer, keyed by backendKey, to the vserver groups it is reached
+// through: the default group of the listener and, for HTTP and HTTPS
+// listeners, the groups of its forwarding rules. A backend server can be in
+// several groups, so the group is resolved per listener and server rather
+// than per server.
+func backendVServerGroups(client *slb.Client, loadBalancerID string) (map[string][]string, error) {
+	listenerGroups, err := listenerVServerGroups(client, loadBalancerID)
+	if err != nil {
+		return nil, err
+	}
+	members := map[string][]slb.BackendServerInDescribeVServerGroupAttribute{}
+	groups := map[string][]string{}
+	for listener, listenerGroups := range listenerGroups {
+		for _, group := range listenerGroups {
+			servers, ok := members[group]
+			if !ok {
+				request := slb.CreateDescribeVServerGroupAttributeRequest()
+				request.Scheme = "https"
+				request.VServerGroupId = group
+				response, err := client.DescribeVServerGroupAttribute(request)
+				if err != nil {
+					return groups, err
+				}
+				servers = response.BackendServers.BackendServer
+				members[group] = servers
+			}
+			for _, server := range servers {
+				key := backendKey(listener, server.ServerId, server.Port)
+				groups[key] = append(groups[key], group)
+			}
+		}
+	}
+	return groups, nil
+}
+
+// listenerVServerGroups maps the port and protocol of every listener of a load
+// balancer to the sorted vserver groups it forwards to.
+func listenerVServerGroups(client *slb.Client, loadBalancerID string) (map[string][]string, error) {
+	groups := map[string][]string{}
+	request := slb.CreateDescribeLoadBalancerListenersRequest()
+	request.Scheme = "https"
+	request.LoadBalancerId = &[]string{loadBalancerID}
+	request.MaxResults = requests.NewInteger(100)
+	for {
+		response, err := client.DescribeLoadBalancerListeners(request)
+		if err != nil {
+			return groups, err
+		}
+		for _, listener := range response.Listeners {
+			key := listenerKey(listener.ListenerPort, listener.ListenerProtocol)
+			set := map[string]bool{}
+			if listener.VServerGroupId != "" {
+				set[listener.VServerGroupId] = true
+			}
+			if protocol := strings.ToLower(listener.ListenerProtocol); protocol == "http" || protocol == "https" {
+				rules := slb.CreateDescribeRulesRequest()
+				rules.Scheme = "https"
+				rules.LoadBalancerId = loadBalancerID
+				rules.ListenerPort = requests.NewInteger(listener.ListenerPort)
+				rules.ListenerProtocol = protocol
+				response, err := client.DescribeRules(rules)
+				if err != nil {
+					return groups, err
+				}
+				for _, rule := range response.Rules.Rule {
+					if rule.VServerGroupId != "" {
+						set[rule.VServerGroupId] = true
+					}
+				}
+			}
+			for group := range set {
+				groups[key] = append(groups[key], group)
+			}
+			sort.Strings(groups[key])
+		}
+		if response.NextToken == "" {
+			return groups, nil
+		}
+		request.NextToken = response.NextToken
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+)
+
+// slbSpec holds the limits of a performance-guaranteed instance spec.
+type slbSpec struct {
+	maxConnections float64
+	newConnections float64
+	qps            float64
+}
+
+var slbSpecs = map[string]slbSpec{
+	"slb.s1.small":   {5000, 3000, 1000},
+	"slb.s2.small":   {50000, 5000, 5000},
+	"slb.s2.medium":  {100000, 10000, 10000},
+	"slb.s3.small":   {200000, 20000, 20000},
+	"slb.s3.medium":  {500000, 50000, 30000},
+	"slb.s3.large":   {1000000, 100000, 50000},
+	"slb.s3.xlarge":  {2000000, 200000, 100000},
+	"slb.s3.xxlarge": {5000000, 500000, 200000},
+}
+
+// capacityMetrics are the instance metrics compared against the spec and
+// bandwidth limits.
+var capacityMetrics = map[string]bool{
+	"InstanceMaxConnection": true,
+	"InstanceNewConnection": true,
+	"InstanceQps":           true,
+	"InstanceTrafficRX":     true,
+	"InstanceTrafficTX":     true,
+}
+
+func newInventoryMetrics() map[string]*prometheus.Desc {
+	return map[string]*prometheus.Desc{
+		"instance_info":                    newECSMetric("instance_info", "Load balancer spec and addressing, always 1.", []string{"id", "name", "spec", "address", "address_type", "network_type", "status"}),
+		"listener_info":                    newECSMetric("listener_info", "Listener configured on the load balancer, always 1.", []string{"id", "listener_port", "protocol", "forward", "forward_port"}),
+		"bandwidth_limit_bits_per_second":  newECSMetric("bandwidth_limit_bits_per_second", "Bandwidth cap of the load balancer in bits per second.", instanceLabels),
+		"spec_max_connections":             newECSMetric("spec_max_connections", "Maximum concurrent connections allowed by the spec.", instanceLabels),
+		"spec_new_connections":             newECSMetric("spec_new_connections", "Maximum new connections per second allowed by the spec.", instanceLabels),
+		"spec_qps":                         newECSMetric("spec_qps", "Maximum layer-7 requests per second allowed by the spec.", instanceLabels),
+		"max_connection_utilization_ratio": newECSMetric("max_connection_utilization_ratio", "InstanceMaxConnection divided by the spec connection limit.", instanceLabels),
+		"new_connection_utilization_ratio": newECSMetric("new_connection_utilization_ratio", "InstanceNewConnection divided by the spec new connection limit.", instanceLabels),
+		"qps_utilization_ratio":            newECSMetric("qps_utilization_ratio", "InstanceQps divided by the spec QPS limit.", instanceLabels),
+		"traffic_rx_utilization_ratio":     newECSMetric("traffic_rx_utilization_ratio", "InstanceTrafficRX divided by the bandwidth cap.", instanceLabels),
+		"traffic_tx_utilization_ratio":     newECSMetric("traffic_tx_utilization_ratio", "InstanceTrafficTX divided by the bandwidth cap.", instanceLabels),
+	}
+}
+
+// collectInventory exports the spec, bandwidth cap and listeners of every load
+// balancer, and how much of the spec and bandwidth the usage in this scrape
+// takes up. usage holds the capacityMetrics values by metric and instance id.
+func (e Exporter) collectInventory(ch chan<- prometheus.Metric, loadBalancers []loadBalancer, usage map[string]map[string]float64) {
+	gauge := func(name string, value float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(e.inventoryMetric[name], prometheus.GaugeValue, value, labels...)
+	}
+	utilization := func(name string, metric string, id string, limit float64) {
+		if value, ok := usage[metric][id]; ok && limit > 0 {
+			gauge(name, value/limit, id)
+		}
+	}
+	for _, lb := range loadBalancers {
+		attribute := lb.attribute
+		if attribute == nil {
+			continue
+		}
+		id := attribute.LoadBalancerId
+		gauge("instance_info", 1, id, attribute.LoadBalancerName, attribute.LoadBalancerSpec, attribute.Address, attribute.AddressType, attribute.NetworkType, attribute.LoadBalancerStatus)
+		for _, listener := range attribute.ListenerPortsAndProtocol.ListenerPortAndProtocol {
+			gauge("listener_info", 1, id, strconv.Itoa(listener.ListenerPort), listener.ListenerProtocol, listener.ListenerForward, strconv.Itoa(listener.ForwardPort))
+		}
+		if attribute.Bandwidth > 0 {
+			bandwidth := float64(attribute.Bandwidth) * 1000 * 1000
+			gauge("bandwidth_limit_bits_per_second", bandwidth, id)
+			utilization("traffic_rx_utilization_ratio", "InstanceTrafficRX", id, bandwidth)
+			utilization("traffic_tx_utilization_ratio", "InstanceTrafficTX", id, bandwidth)
+		}
+		if spec, ok := slbSpecs[attribute.LoadBalancerSpec]; ok {
+			gauge("spec_max_connections", spec.maxConnections, id)
+			gauge("spec_new_connections", spec.newConnections, id)
+			gauge("spec_qps", spec.qps, id)
+			utilization("max_connection_utilization_ratio", "InstanceMaxConnection", id, spec.maxConnections)
+			utilization("new_connection_utilization_ratio", "InstanceNewConnection", id, spec.newConnections)
+			utilization("qps_utilization_ratio", "InstanceQps", id, spec.qps)
+		}
+	}
+}
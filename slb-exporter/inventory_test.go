@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/slb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"strings"
+	"testing"
+)
+
+// collectorFunc collects the metrics of a function, unchecked.
+type collectorFunc func(ch chan<- prometheus.Metric)
+
+func (f collectorFunc) Describe(ch chan<- *prometheus.Desc) {}
+
+func (f collectorFunc) Collect(ch chan<- prometheus.Metric) {
+	f(ch)
+}
+
+func TestCollectInventoryUtilization(t *testing.T) {
+	e := newExporter()
+	loadBalancers := []loadBalancer{
+		{attribute: &slb.DescribeLoadBalancerAttributeResponse{LoadBalancerId: "lb-1", LoadBalancerSpec: "slb.s2.small", Bandwidth: 10}},
+		// Without a known spec or bandwidth cap there is nothing to compare
+		// against.
+		{attribute: &slb.DescribeLoadBalancerAttributeResponse{LoadBalancerId: "lb-2", LoadBalancerSpec: "slb.lcu.elastic"}},
+		// Not described, skipped.
+		{},
+	}
+	usage := map[string]map[string]float64{
+		"InstanceMaxConnection": {"lb-1": 25000, "lb-2": 100},
+		"InstanceNewConnection": {"lb-1": 500},
+		"InstanceQps":           {"lb-2": 100},
+		"InstanceTrafficRX":     {"lb-1": 5e6},
+		"InstanceTrafficTX":     {"lb-1": 1e6},
+	}
+	expected := `
+# HELP aliyun_slb_max_connection_utilization_ratio InstanceMaxConnection divided by the spec connection limit.
+# TYPE aliyun_slb_max_connection_utilization_ratio gauge
+aliyun_slb_max_connection_utilization_ratio{id="lb-1"} 0.5
+# HELP aliyun_slb_new_connection_utilization_ratio InstanceNewConnection divided by the spec new connection limit.
+# TYPE aliyun_slb_new_connection_utilization_ratio gauge
+aliyun_slb_new_connection_utilization_ratio{id="lb-1"} 0.1
+# HELP aliyun_slb_traffic_rx_utilization_ratio InstanceTrafficRX divided by the bandwidth cap.
+# TYPE aliyun_slb_traffic_rx_utilization_ratio gauge
+aliyun_slb_traffic_rx_utilization_ratio{id="lb-1"} 0.5
+# HELP aliyun_slb_traffic_tx_utilization_ratio InstanceTrafficTX divided by the bandwidth cap.
+# TYPE aliyun_slb_traffic_tx_utilization_ratio gauge
+aliyun_slb_traffic_tx_utilization_ratio{id="lb-1"} 0.1
+# HELP aliyun_slb_spec_max_connections Maximum concurrent connections allowed by the spec.
+# TYPE aliyun_slb_spec_max_connections gauge
+aliyun_slb_spec_max_connections{id="lb-1"} 50000
+# HELP aliyun_slb_bandwidth_limit_bits_per_second Bandwidth cap of the load balancer in bits per second.
+# TYPE aliyun_slb_bandwidth_limit_bits_per_second gauge
+aliyun_slb_bandwidth_limit_bits_per_second{id="lb-1"} 1e+07
+`
+	collector := collectorFunc(func(ch chan<- prometheus.Metric) {
+		e.collectInventory(ch, loadBalancers, usage)
+	})
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"aliyun_slb_max_connection_utilization_ratio",
+		"aliyun_slb_new_connection_utilization_ratio",
+		"aliyun_slb_qps_utilization_ratio",
+		"aliyun_slb_traffic_rx_utilization_ratio",
+		"aliyun_slb_traffic_tx_utilization_ratio",
+		"aliyun_slb_spec_max_connections",
+		"aliyun_slb_bandwidth_limit_bits_per_second",
+	); err != nil {
+		t.Error(err)
+	}
+}
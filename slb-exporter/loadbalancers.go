@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/slb"
+	"log"
+)
+
+func newSLBClient() (*slb.Client, error) {
+	return slb.NewClientWithAccessKey("cn-hangzhou", "secretid", "secretkey")
+}
+
+// describeLoadBalancers pages through DescribeLoadBalancers and returns every
+// load balancer in the region.
+func describeLoadBalancers(client *slb.Client) ([]slb.LoadBalancer, error) {
+	var loadBalancers []slb.LoadBalancer
+	request := slb.CreateDescribeLoadBalancersRequest()
+	request.Scheme = "https"
+	request.PageSize = requests.NewInteger(100)
+	for page := 1; ; page++ {
+		request.PageNumber = requests.NewInteger(page)
+		response, err := client.DescribeLoadBalancers(request)
+		if err != nil {
+			return nil, err
+		}
+		loadBalancers = append(loadBalancers, response.LoadBalancers.LoadBalancer...)
+		if len(response.LoadBalancers.LoadBalancer) == 0 || len(loadBalancers) >= response.TotalCount {
+			return loadBalancers, nil
+		}
+	}
+}
+
+func describeLoadBalancerAttribute(client *slb.Client, loadBalancerID string) (*slb.DescribeLoadBalancerAttributeResponse, error) {
+	request := slb.CreateDescribeLoadBalancerAttributeRequest()
+	request.Scheme = "https"
+	request.LoadBalancerId = loadBalancerID
+	return client.DescribeLoadBalancerAttribute(request)
+}
+
+// loadBalancer is a load balancer together with its attribute, listed once per
+// scrape and shared by the collectors. attribute is nil when it was not asked
+// for or could not be described.
+type loadBalancer struct {
+	slb.LoadBalancer
+	attribute *slb.DescribeLoadBalancerAttributeResponse
+}
+
+// listLoadBalancers returns every load balancer in the region, described with
+// DescribeLoadBalancerAttribute when withAttributes is set.
+func listLoadBalancers(client *slb.Client, withAttributes bool) ([]loadBalancer, error) {
+	described, err := describeLoadBalancers(client)
+	if err != nil {
+		return nil, err
+	}
+	loadBalancers := make([]loadBalancer, 0, len(described))
+	for _, lb := range described {
+		var attribute *slb.DescribeLoadBalancerAttributeResponse
+		if withAttributes {
+			attribute, err = describeLoadBalancerAttribute(client, lb.LoadBalancerId)
+			if err != nil {
+				log.Printf("load balancer %s: %v", lb.LoadBalancerId, err)
+				attribute = nil
+			}
+		}
+		loadBalancers = append(loadBalancers, loadBalancer{lb, attribute})
+	}
+	return loadBalancers, nil
+}
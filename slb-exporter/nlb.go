@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const nlbNamespace = "acs_nlb"
+
+// nlbMetricLabels holds the labels of the acs_nlb metrics apart from
+// metricLabels, as NLB reports some metrics under the same CMS names as SLB.
+var nlbMetricLabels = map[string][]string{}
+
+var (
+	nlbInstanceLabels    = []string{"loadBalancerId"}
+	nlbListenerLabels    = []string{"loadBalancerId", "listenerProtocol", "listenerPort"}
+	nlbServerGroupLabels = []string{"loadBalancerId", "serverGroupId"}
+)
+
+// newNLBMetric describes a metric of the acs_nlb namespace, labelled after its
+// CMS dimensions like the ALB metrics.
+func newNLBMetric(metricName string, docString string, labels []string) *prometheus.Desc {
+	nlbMetricLabels[metricName] = labels
+	return prometheus.NewDesc(
+		prometheus.BuildFQName("aliyun", "nlb", metricName),
+		docString, labels, nil,
+	)
+}
+
+// newNLBExporter returns an exporter for the acs_nlb namespace, collected
+// through the same path as the SLB metrics by the SLB exporter.
+func newNLBExporter() *Exporter {
+	return &Exporter{
+		namespace:    nlbNamespace,
+		metricLabels: nlbMetricLabels,
+		newStatusMetric: map[string]*prometheus.Desc{
+			"InstanceActiveConnection": newNLBMetric("InstanceActiveConnection", "Active connections of the load balancer.", nlbInstanceLabels),
+			"InstanceNewConnection":    newNLBMetric("InstanceNewConnection", "New connections per second of the load balancer.", nlbInstanceLabels),
+			"InstanceDropConnection":   newNLBMetric("InstanceDropConnection", "Connections dropped per second by the load balancer.", nlbInstanceLabels),
+			"InstancePacketRX":         newNLBMetric("InstancePacketRX", "Inbound packets per second of the load balancer.", nlbInstanceLabels),
+			"InstancePacketTX":         newNLBMetric("InstancePacketTX", "Outbound packets per second of the load balancer.", nlbInstanceLabels),
+			"InstanceDropPacketRX":     newNLBMetric("InstanceDropPacketRX", "Inbound packets dropped per second by the load balancer.", nlbInstanceLabels),
+			"InstanceDropPacketTX":     newNLBMetric("InstanceDropPacketTX", "Outbound packets dropped per second by the load balancer.", nlbInstanceLabels),
+			"InstanceTrafficRX":        newNLBMetric("InstanceTrafficRX", "Inbound traffic of the load balancer in bits per second.", nlbInstanceLabels),
+			"InstanceTrafficTX":        newNLBMetric("InstanceTrafficTX", "Outbound traffic of the load balancer in bits per second.", nlbInstanceLabels),
+			"InstanceDropTrafficRX":    newNLBMetric("InstanceDropTrafficRX", "Inbound traffic dropped by the load balancer in bits per second.", nlbInstanceLabels),
+			"InstanceDropTrafficTX":    newNLBMetric("InstanceDropTrafficTX", "Outbound traffic dropped by the load balancer in bits per second.", nlbInstanceLabels),
+
+			"ListenerActiveConnection":     newNLBMetric("ListenerActiveConnection", "Active connections of the listener.", nlbListenerLabels),
+			"ListenerNewConnection":        newNLBMetric("ListenerNewConnection", "New connections per second of the listener.", nlbListenerLabels),
+			"ListenerDropConnection":       newNLBMetric("ListenerDropConnection", "Connections dropped per second by the listener.", nlbListenerLabels),
+			"ListenerPacketRX":             newNLBMetric("ListenerPacketRX", "Inbound packets per second of the listener.", nlbListenerLabels),
+			"ListenerPacketTX":             newNLBMetric("ListenerPacketTX", "Outbound packets per second of the listener.", nlbListenerLabels),
+			"ListenerDropPacketRX":         newNLBMetric("ListenerDropPacketRX", "Inbound packets dropped per second by the listener.", nlbListenerLabels),
+			"ListenerDropPacketTX":         newNLBMetric("ListenerDropPacketTX", "Outbound packets dropped per second by the listener.", nlbListenerLabels),
+			"ListenerTrafficRX":            newNLBMetric("ListenerTrafficRX", "Inbound traffic of the listener in bits per second.", nlbListenerLabels),
+			"ListenerTrafficTX":            newNLBMetric("ListenerTrafficTX", "Outbound traffic of the listener in bits per second.", nlbListenerLabels),
+			"ListenerHeathyServerCount":    newNLBMetric("ListenerHeathyServerCount", "Healthy backend servers of the listener.", nlbListenerLabels),
+			"ListenerUnhealthyServerCount": newNLBMetric("ListenerUnhealthyServerCount", "Unhealthy backend servers of the listener.", nlbListenerLabels),
+
+			"ServerGroupUnhealthyServerCount": newNLBMetric("ServerGroupUnhealthyServerCount", "Unhealthy backend servers of the server group.", nlbServerGroupLabels),
+		},
+	}
+}
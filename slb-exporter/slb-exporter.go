@@ -1,6 +1,7 @@
 package main
 
 import (
+	"aliyun-exporter/internal/cmsutil"
 	"encoding/json"
 	"flag"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/cms"
@@ -8,126 +9,390 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 )
 
+const namespace = "acs_slb_dashboard"
+
 type Exporter struct {
-	newStatusMetric map[string]*prometheus.Desc
+	namespace            string
+	metricLabels         map[string][]string
+	newStatusMetric      map[string]*prometheus.Desc
+	backendServerHealthy *prometheus.Desc
+	backendHealth        bool
+	inventoryMetric      map[string]*prometheus.Desc
+	inventory            bool
+	certificateExpiry    *prometheus.Desc
+	certificates         bool
+	limiter              *cmsutil.SeriesLimiter
+	aggregations         map[string][]cmsutil.Aggregation
+	keepRaw              bool
+	lookback             time.Duration
+	cache                *cmsutil.StaleCache
+	nlb                  *Exporter
 }
 
-type Cpu []struct {
+type Cpu []Datapoint
+
+type Datapoint struct {
 	Timestamp  int64   `json:"timestamp"`
 	UserID     string  `json:"userId"`
 	InstanceID string  `json:"instanceId"`
 	Port       string  `json:"port"`
 	Protocol   string  `json:"protocol"`
 	Vip        string  `json:"vip"`
+	GroupID    string  `json:"groupId"`
 	Maximum    float64 `json:"Maximum"`
 	Minimum    float64 `json:"Minimum"`
 	Average    float64 `json:"Average"`
+
+	// NLB datapoints name their dimensions after the load balancer,
+	// listener and server group, some are keyed by instanceId instead.
+	LoadBalancerID   string `json:"loadBalancerId"`
+	ListenerProtocol string `json:"listenerProtocol"`
+	ListenerPort     string `json:"listenerPort"`
+	ServerGroupID    string `json:"serverGroupId"`
 }
 
+var metricLabels = map[string][]string{}
+
 func newECSMetric(metricName string, docString string, labels []string) *prometheus.Desc {
+	metricLabels[metricName] = labels
 	return prometheus.NewDesc(
 		prometheus.BuildFQName("aliyun", "slb", metricName),
 		docString, labels, nil,
 	)
 }
 
+var (
+	instanceLabels = []string{"id"}
+	listenerLabels = []string{"id", "protocol", "port", "vip"}
+	layer7Labels   = []string{"id", "protocol", "port"}
+	groupLabels    = []string{"group_id"}
+)
+
+// newInstanceMetric describes an instance-wide metric, CMS reports these
+// without port, protocol or vip.
+func newInstanceMetric(metricName string, docString string) *prometheus.Desc {
+	return newECSMetric(metricName, docString, instanceLabels)
+}
+
+// newListenerMetric describes a per-listener layer-4 metric.
+func newListenerMetric(metricName string, docString string) *prometheus.Desc {
+	return newECSMetric(metricName, docString, listenerLabels)
+}
+
+// newLayer7Metric describes a per-listener metric of HTTP and HTTPS
+// listeners, CMS reports these without vip.
+func newLayer7Metric(metricName string, docString string) *prometheus.Desc {
+	return newECSMetric(metricName, docString, layer7Labels)
+}
+
+// newGroupMetric describes a per-vserver-group metric.
+func newGroupMetric(metricName string, docString string) *prometheus.Desc {
+	return newECSMetric(metricName, docString, groupLabels)
+}
+
 func newExporter() *Exporter {
 	return &Exporter{
+		namespace:            namespace,
+		metricLabels:         metricLabels,
+		inventoryMetric:      newInventoryMetrics(),
+		certificateExpiry:    newECSMetric("certificate_expiry_timestamp_seconds", "Expiry time of the server certificate bound to the HTTPS listener.", []string{"id", "listener_port", "cert_id", "common_name"}),
+		backendServerHealthy: newECSMetric("backend_server_healthy", "Whether the backend server passes the health check of the listener.", []string{"id", "listener_port", "protocol", "server_id", "server_ip", "server_port", "vserver_group"}),
 		newStatusMetric: map[string]*prometheus.Desc{
-			"ActiveConnection":                 newECSMetric("ActiveConnection", "ActiveConnection", []string{"id", "protocol", "port", "vip"}),
-			"DropConnection":                   newECSMetric("DropConnection", "DropConnection", []string{"id", "protocol", "port", "vip"}),
-			"DropPackerRX":                     newECSMetric("DropPackerRX", "DropPackerRX", []string{"id", "protocol", "port", "vip"}),
-			"DropPackerTX":                     newECSMetric("DropPackerTX", "DropPackerTX", []string{"id", "protocol", "port", "vip"}),
-			"DropTrafficRX":                    newECSMetric("DropTrafficRX", "DropTrafficRX", []string{"id", "protocol", "port", "vip"}),
-			"DropTrafficTX":                    newECSMetric("DropTrafficTX", "DropTrafficTX", []string{"id", "protocol", "port", "vip"}),
-			"HeathyServerCount":                newECSMetric("HeathyServerCount", "HeathyServerCount", []string{"id", "protocol", "port", "vip"}),
-			"InactiveConnection":               newECSMetric("InactiveConnection", "InactiveConnection", []string{"id", "protocol", "port", "vip"}),
-			"InstanceActiveConnection":         newECSMetric("InstanceActiveConnection", "InstanceActiveConnection", []string{"id", "protocol", "port", "vip"}),
-			"InstanceDropConnection":           newECSMetric("InstanceDropConnection", "InstanceDropConnection", []string{"id", "protocol", "port", "vip"}),
-			"InstanceDropPacketRX":             newECSMetric("InstanceDropPacketRX", "InstanceDropPacketRX", []string{"id", "protocol", "port", "vip"}),
-			"InstanceDropPacketTX":             newECSMetric("InstanceDropPacketTX", "InstanceDropPacketTX", []string{"id", "protocol", "port", "vip"}),
-			"InstanceDropTrafficRX":            newECSMetric("InstanceDropTrafficRX", "InstanceDropTrafficRX", []string{"id", "protocol", "port", "vip"}),
-			"InstanceDropTrafficTX":            newECSMetric("InstanceDropTrafficTX", "InstanceDropTrafficTX", []string{"id", "protocol", "port", "vip"}),
-			"InstanceInactiveConnection":       newECSMetric("InstanceInactiveConnection", "InstanceInactiveConnection", []string{"id", "protocol", "port", "vip"}),
-			"InstanceMaxConnection":            newECSMetric("InstanceMaxConnection", "InstanceMaxConnection", []string{"id", "protocol", "port", "vip"}),
-			"InstanceMaxConnectionUtilization": newECSMetric("InstanceMaxConnectionUtilization", "InstanceMaxConnectionUtilization", []string{"id", "protocol", "port", "vip"}),
-			"InstanceNewConnection":            newECSMetric("InstanceNewConnection", "InstanceNewConnection", []string{"id", "protocol", "port", "vip"}),
-			"InstanceNewConnectionUtilization": newECSMetric("InstanceNewConnectionUtilization", "InstanceNewConnectionUtilization", []string{"id", "protocol", "port", "vip"}),
-			"InstancePacketRX":                 newECSMetric("InstancePacketRX", "InstancePacketRX", []string{"id", "protocol", "port", "vip"}),
-			"InstancePacketTX":                 newECSMetric("InstancePacketTX", "InstancePacketTX", []string{"id", "protocol", "port", "vip"}),
-			"InstanceQps":                      newECSMetric("InstanceQps", "InstanceQps", []string{"id", "protocol", "port", "vip"}),
-			"InstanceQpsUtilization":           newECSMetric("InstanceQpsUtilization", "InstanceQpsUtilization", []string{"id", "protocol", "port", "vip"}),
-			"InstanceRt":                       newECSMetric("InstanceRt", "InstanceRt", []string{"id", "protocol", "port", "vip"}),
-			"InstanceStatusCode2xx":            newECSMetric("InstanceStatusCode2xx", "InstanceStatusCode2xx", []string{"id", "protocol", "port", "vip"}),
-			"InstanceStatusCode3xx":            newECSMetric("InstanceStatusCode3xx", "InstanceStatusCode3xx", []string{"id", "protocol", "port", "vip"}),
-			"InstanceStatusCode4xx":            newECSMetric("InstanceStatusCode4xx", "InstanceStatusCode4xx", []string{"id", "protocol", "port", "vip"}),
-			"InstanceStatusCode5xx":            newECSMetric("InstanceStatusCode5xx", "InstanceStatusCode5xx", []string{"id", "protocol", "port", "vip"}),
-			"InstanceStatusCodeOther":          newECSMetric("InstanceStatusCodeOther", "InstanceStatusCodeOther", []string{"id", "protocol", "port", "vip"}),
-			"InstanceTrafficRX":                newECSMetric("InstanceTrafficRX", "InstanceTrafficRX", []string{"id", "protocol", "port", "vip"}),
-			"InstanceTrafficTX":                newECSMetric("InstanceTrafficTX", "InstanceTrafficTX", []string{"id", "protocol", "port", "vip"}),
-			"InstanceUpstreamCode4xx":          newECSMetric("InstanceUpstreamCode4xx", "InstanceUpstreamCode4xx", []string{"id", "protocol", "port", "vip"}),
-			"InstanceUpstreamCode5xx":          newECSMetric("InstanceUpstreamCode5xx", "InstanceUpstreamCode5xx", []string{"id", "protocol", "port", "vip"}),
-			"InstanceUpstreamRt":               newECSMetric("InstanceUpstreamRt", "InstanceUpstreamRt", []string{"id", "protocol", "port", "vip"}),
-			"MaxConnection":                    newECSMetric("MaxConnection", "MaxConnection", []string{"id", "protocol", "port", "vip"}),
-			"NewConnection":                    newECSMetric("NewConnection", "NewConnection", []string{"id", "protocol", "port", "vip"}),
-			"PacketRX":                         newECSMetric("PacketRX", "PacketRX", []string{"id", "protocol", "port", "vip"}),
-			"PacketTX":                         newECSMetric("PacketTX", "PacketTX", []string{"id", "protocol", "port", "vip"}),
-			"Qps":                              newECSMetric("Qps", "Qps", []string{"id", "protocol", "port", "vip"}),
-			"Rt":                               newECSMetric("Rt", "Rt", []string{"id", "protocol", "port", "vip"}),
-			"StatusCode2xx":                    newECSMetric("StatusCode2xx", "StatusCode2xx", []string{"id", "protocol", "port", "vip"}),
-			"StatusCode3xx":                    newECSMetric("StatusCode3xx", "StatusCode3xx", []string{"id", "protocol", "port", "vip"}),
-			"StatusCode4xx":                    newECSMetric("StatusCode4xx", "StatusCode4xx", []string{"id", "protocol", "port", "vip"}),
-			"StatusCode5xx":                    newECSMetric("StatusCode5xx", "StatusCode5xx", []string{"id", "protocol", "port", "vip"}),
-			"StatusCodeOther":                  newECSMetric("StatusCodeOther", "StatusCodeOther", []string{"id", "protocol", "port", "vip"}),
-			"TrafficRXNew":                     newECSMetric("TrafficRXNew", "TrafficRXNew", []string{"id", "protocol", "port", "vip"}),
-			"TrafficTXNew":                     newECSMetric("TrafficTXNew", "TrafficTXNew", []string{"id", "protocol", "port", "vip"}),
-			"UnhealthyServerCount":             newECSMetric("UnhealthyServerCount", "UnhealthyServerCount", []string{"id", "protocol", "port", "vip"}),
-			"UpstreamCode4xx":                  newECSMetric("UpstreamCode4xx", "UpstreamCode4xx", []string{"id", "protocol", "port", "vip"}),
-			"UpstreamCode5xx":                  newECSMetric("UpstreamCode5xx", "UpstreamCode5xx", []string{"id", "protocol", "port", "vip"}),
-			"UpstreamRt":                       newECSMetric("UpstreamRt", "UpstreamRt", []string{"id", "protocol", "port", "vip"}),
-			"GroupTotalTrafficRX":              newECSMetric("GroupTotalTrafficRX", "GroupTotalTrafficRX", []string{"id", "protocol", "port", "vip"}),
-			"GroupTotalTrafficTX":              newECSMetric("GroupTotalTrafficTX", "GroupTotalTrafficTX", []string{"id", "protocol", "port", "vip"}),
+			"InstanceActiveConnection":         newInstanceMetric("InstanceActiveConnection", "Active connections of the instance."),
+			"InstanceDropConnection":           newInstanceMetric("InstanceDropConnection", "Connections dropped per second by the instance."),
+			"InstanceDropPacketRX":             newInstanceMetric("InstanceDropPacketRX", "Inbound packets dropped per second by the instance."),
+			"InstanceDropPacketTX":             newInstanceMetric("InstanceDropPacketTX", "Outbound packets dropped per second by the instance."),
+			"InstanceDropTrafficRX":            newInstanceMetric("InstanceDropTrafficRX", "Inbound traffic dropped by the instance in bits per second."),
+			"InstanceDropTrafficTX":            newInstanceMetric("InstanceDropTrafficTX", "Outbound traffic dropped by the instance in bits per second."),
+			"InstanceInactiveConnection":       newInstanceMetric("InstanceInactiveConnection", "Inactive connections of the instance."),
+			"InstanceMaxConnection":            newInstanceMetric("InstanceMaxConnection", "Concurrent connections of the instance."),
+			"InstanceMaxConnectionUtilization": newInstanceMetric("InstanceMaxConnectionUtilization", "Concurrent connections of the instance as a percentage of the spec limit."),
+			"InstanceNewConnection":            newInstanceMetric("InstanceNewConnection", "New connections per second of the instance."),
+			"InstanceNewConnectionUtilization": newInstanceMetric("InstanceNewConnectionUtilization", "New connections per second of the instance as a percentage of the spec limit."),
+			"InstancePacketRX":                 newInstanceMetric("InstancePacketRX", "Inbound packets per second of the instance."),
+			"InstancePacketTX":                 newInstanceMetric("InstancePacketTX", "Outbound packets per second of the instance."),
+			"InstanceQps":                      newInstanceMetric("InstanceQps", "Layer-7 requests per second of the instance."),
+			"InstanceQpsUtilization":           newInstanceMetric("InstanceQpsUtilization", "Layer-7 requests per second of the instance as a percentage of the spec limit."),
+			"InstanceRt":                       newInstanceMetric("InstanceRt", "Layer-7 response time of the instance in milliseconds."),
+			"InstanceStatusCode2xx":            newInstanceMetric("InstanceStatusCode2xx", "2xx responses per second returned by the instance."),
+			"InstanceStatusCode3xx":            newInstanceMetric("InstanceStatusCode3xx", "3xx responses per second returned by the instance."),
+			"InstanceStatusCode4xx":            newInstanceMetric("InstanceStatusCode4xx", "4xx responses per second returned by the instance."),
+			"InstanceStatusCode5xx":            newInstanceMetric("InstanceStatusCode5xx", "5xx responses per second returned by the instance."),
+			"InstanceStatusCodeOther":          newInstanceMetric("InstanceStatusCodeOther", "Other responses per second returned by the instance."),
+			"InstanceTrafficRX":                newInstanceMetric("InstanceTrafficRX", "Inbound traffic of the instance in bits per second."),
+			"InstanceTrafficTX":                newInstanceMetric("InstanceTrafficTX", "Outbound traffic of the instance in bits per second."),
+			"InstanceUpstreamCode4xx":          newInstanceMetric("InstanceUpstreamCode4xx", "4xx responses per second returned by the backends of the instance."),
+			"InstanceUpstreamCode5xx":          newInstanceMetric("InstanceUpstreamCode5xx", "5xx responses per second returned by the backends of the instance."),
+			"InstanceUpstreamRt":               newInstanceMetric("InstanceUpstreamRt", "Backend response time of the instance in milliseconds."),
+
+			"ActiveConnection":     newListenerMetric("ActiveConnection", "Active connections of the listener."),
+			"DropConnection":       newListenerMetric("DropConnection", "Connections dropped per second by the listener."),
+			"DropPackerRX":         newListenerMetric("DropPackerRX", "Inbound packets dropped per second by the listener."),
+			"DropPackerTX":         newListenerMetric("DropPackerTX", "Outbound packets dropped per second by the listener."),
+			"DropTrafficRX":        newListenerMetric("DropTrafficRX", "Inbound traffic dropped by the listener in bits per second."),
+			"DropTrafficTX":        newListenerMetric("DropTrafficTX", "Outbound traffic dropped by the listener in bits per second."),
+			"HeathyServerCount":    newListenerMetric("HeathyServerCount", "Healthy backend servers of the listener."),
+			"InactiveConnection":   newListenerMetric("InactiveConnection", "Inactive connections of the listener."),
+			"MaxConnection":        newListenerMetric("MaxConnection", "Concurrent connections of the listener."),
+			"NewConnection":        newListenerMetric("NewConnection", "New connections per second of the listener."),
+			"PacketRX":             newListenerMetric("PacketRX", "Inbound packets per second of the listener."),
+			"PacketTX":             newListenerMetric("PacketTX", "Outbound packets per second of the listener."),
+			"TrafficRXNew":         newListenerMetric("TrafficRXNew", "Inbound traffic of the listener in bits per second."),
+			"TrafficTXNew":         newListenerMetric("TrafficTXNew", "Outbound traffic of the listener in bits per second."),
+			"UnhealthyServerCount": newListenerMetric("UnhealthyServerCount", "Unhealthy backend servers of the listener."),
+
+			"Qps":             newLayer7Metric("Qps", "Requests per second of the listener."),
+			"Rt":              newLayer7Metric("Rt", "Response time of the listener in milliseconds."),
+			"StatusCode2xx":   newLayer7Metric("StatusCode2xx", "2xx responses per second returned by the listener."),
+			"StatusCode3xx":   newLayer7Metric("StatusCode3xx", "3xx responses per second returned by the listener."),
+			"StatusCode4xx":   newLayer7Metric("StatusCode4xx", "4xx responses per second returned by the listener."),
+			"StatusCode5xx":   newLayer7Metric("StatusCode5xx", "5xx responses per second returned by the listener."),
+			"StatusCodeOther": newLayer7Metric("StatusCodeOther", "Other responses per second returned by the listener."),
+			"UpstreamCode4xx": newLayer7Metric("UpstreamCode4xx", "4xx responses per second returned by the backends of the listener."),
+			"UpstreamCode5xx": newLayer7Metric("UpstreamCode5xx", "5xx responses per second returned by the backends of the listener."),
+			"UpstreamRt":      newLayer7Metric("UpstreamRt", "Backend response time of the listener in milliseconds."),
+
+			"GroupTotalTrafficRX": newGroupMetric("GroupTotalTrafficRX", "Inbound traffic of the vserver group in bits per second."),
+			"GroupTotalTrafficTX": newGroupMetric("GroupTotalTrafficTX", "Outbound traffic of the vserver group in bits per second."),
 		},
 	}
 }
 
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	e.describeMetrics(ch)
+	if e.nlb != nil {
+		e.nlb.describeMetrics(ch)
+	}
+	if e.backendHealth {
+		ch <- e.backendServerHealthy
+	}
+	if e.inventory {
+		for _, m := range e.inventoryMetric {
+			ch <- m
+		}
+	}
+	if e.certificates {
+		ch <- e.certificateExpiry
+	}
+	e.cache.Describe(ch)
+}
+
+// describeMetrics describes the metrics of the generic collection path.
+func (e *Exporter) describeMetrics(ch chan<- *prometheus.Desc) {
 	for _, m := range e.newStatusMetric {
 		ch <- m
 	}
+	for _, aggregations := range e.aggregations {
+		for _, a := range aggregations {
+			ch <- a.Desc
+		}
+	}
+	e.limiter.Describe(ch)
 }
 
 func (e Exporter) Collect(ch chan<- prometheus.Metric) {
-	for metric, desc := range e.newStatusMetric {
-		request := cms.CreateDescribeMetricLastRequest()
-		request.Scheme = "https"
-		request.MetricName = metric
-		request.Namespace = "acs_slb_dashboard"
-		request.AcceptFormat = "json"
-		client, _ := cms.NewClientWithAccessKey("cn-hangzhou", "secretid", "secretkey")
-		response, err := client.DescribeMetricLast(request)
+	usage := e.collectMetrics(ch)
+	if e.nlb != nil {
+		e.nlb.collectMetrics(ch)
+	}
+	if e.backendHealth || e.inventory || e.certificates {
+		e.collectLoadBalancers(ch, usage)
+	}
+	e.cache.Collect(ch)
+}
+
+// collectMetrics exports the CMS metrics of the exporter's namespace and
+// returns the capacityMetrics values by metric and instance id.
+func (e Exporter) collectMetrics(ch chan<- prometheus.Metric) map[string]map[string]float64 {
+	metrics := make([]string, 0, len(e.newStatusMetric))
+	for metric := range e.newStatusMetric {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	emitted := 0
+	usage := map[string]map[string]float64{}
+	for _, metric := range metrics {
+		datapoints, err := e.cache.Get(e.namespace, metric, e.fetch)
 		if err != nil {
 			continue
 		}
 		var user Cpu
-		json.Unmarshal([]byte(string(response.Datapoints)), &user)
+		json.Unmarshal([]byte(datapoints), &user)
+		if capacityMetrics[metric] {
+			usage[metric] = map[string]float64{}
+			for _, value := range user {
+				usage[metric][value.InstanceID] = value.Average
+			}
+		}
+		samples := make([]cmsutil.Sample, 0, len(user))
+		seen := map[string]bool{}
 		for _, value := range user {
-			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value.Average, value.InstanceID, value.Protocol, value.Port, value.Vip)
+			labels := e.labelValues(metric, value)
+			// A dimension CMS reports under an unexpected key leaves its
+			// label empty and would export duplicate series, failing the
+			// whole scrape.
+			key := strings.Join(labels, "\xff")
+			if seen[key] {
+				log.Printf("%s %s: dropping duplicate series %v", e.namespace, metric, labels)
+				continue
+			}
+			seen[key] = true
+			samples = append(samples, cmsutil.Sample{Labels: labels, Value: value.Average})
+		}
+		for _, a := range e.aggregations[metric] {
+			for _, s := range e.limiter.Limit(a.Name, a.Apply(samples), &emitted) {
+				ch <- prometheus.MustNewConstMetric(a.Desc, prometheus.GaugeValue, s.Value, s.Labels...)
+			}
+		}
+		if len(e.aggregations[metric]) > 0 && !e.keepRaw {
+			continue
+		}
+		for _, s := range e.limiter.Limit(metric, samples, &emitted) {
+			ch <- prometheus.MustNewConstMetric(e.newStatusMetric[metric], prometheus.GaugeValue, s.Value, s.Labels...)
 		}
 	}
+	e.limiter.Collect(ch)
+	return usage
+}
+
+// collectLoadBalancers lists the load balancers once and hands them to the
+// enabled API collectors.
+func (e Exporter) collectLoadBalancers(ch chan<- prometheus.Metric, usage map[string]map[string]float64) {
+	client, err := newSLBClient()
+	if err != nil {
+		log.Printf("load balancers: %v", err)
+		return
+	}
+	loadBalancers, err := listLoadBalancers(client, e.inventory || e.certificates)
+	if err != nil {
+		log.Printf("load balancers: %v", err)
+		return
+	}
+	if e.backendHealth {
+		e.collectBackendHealth(ch, client, loadBalancers)
+	}
+	if e.inventory {
+		e.collectInventory(ch, loadBalancers, usage)
+	}
+	if e.certificates {
+		e.collectCertificates(ch, client, loadBalancers)
+	}
+}
+
+// labelValues picks the datapoint fields matching the labels of the metric's
+// family in the exporter's namespace.
+func (e Exporter) labelValues(metric string, value Datapoint) []string {
+	labels := e.metricLabels[metric]
+	values := make([]string, len(labels))
+	for i, label := range labels {
+		switch label {
+		case "id":
+			values[i] = value.InstanceID
+		case "protocol":
+			values[i] = value.Protocol
+		case "port":
+			values[i] = value.Port
+		case "vip":
+			values[i] = value.Vip
+		case "group_id":
+			values[i] = value.GroupID
+		case "loadBalancerId":
+			values[i] = firstNonEmpty(value.LoadBalancerID, value.InstanceID)
+		case "listenerProtocol":
+			values[i] = firstNonEmpty(value.ListenerProtocol, value.Protocol)
+		case "listenerPort":
+			values[i] = firstNonEmpty(value.ListenerPort, value.Port)
+		case "serverGroupId":
+			values[i] = firstNonEmpty(value.ServerGroupID, value.GroupID)
+		}
+	}
+	return values
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (e Exporter) fetch(namespace string, metric string) (string, error) {
+	client, _ := cms.NewClientWithAccessKey("cn-hangzhou", "secretid", "secretkey")
+	if e.lookback > 0 {
+		return cmsutil.DescribeMetricLatest(client, namespace, metric, e.lookback)
+	}
+	request := cms.CreateDescribeMetricLastRequest()
+	request.Scheme = "https"
+	request.MetricName = metric
+	request.Namespace = namespace
+	request.AcceptFormat = "json"
+	response, err := client.DescribeMetricLast(request)
+	if err != nil {
+		return "", err
+	}
+	return response.Datapoints, nil
 }
 
 var (
 	listenAddress   = flag.String("telemetry.address", ":8026", "Address on which to expose metrics.")
 	metricsEndpoint = flag.String("telemetry.endpoint", "/metrics", "Path under which to expose metrics.")
+	seriesLimit     = flag.Int("series.limit", 0, "Maximum number of series exported per scrape, 0 for no limit.")
+	metricLimits    = flag.String("series.metric-limit", "", "Comma separated per-metric series caps, e.g. Qps=1000,ActiveConnection=1000.")
+	aggregate       = flag.String("aggregate", "", "Comma separated aggregation rules, e.g. Qps=sum:id,ActiveConnection=max:id+protocol.")
+	aggregateRaw    = flag.Bool("aggregate.keep-raw", false, "Export the raw series of aggregated metrics alongside the aggregates.")
+	staleGrace      = flag.Duration("metric.stale-grace", 0, "How long to keep serving the last successful datapoints of a metric while CMS errors, e.g. 10m.")
+	lookback        = flag.Duration("metric.lookback", 0, "Use DescribeMetricList over this window and export the latest datapoint of each series instead of DescribeMetricLast, e.g. 5m.")
+	backendHealth   = flag.Bool("collector.backend-health", false, "Export the health check status of every backend server via DescribeHealthStatus.")
+	inventory       = flag.Bool("collector.inventory", false, "Export load balancer specs, bandwidth caps, listeners and capacity utilization via DescribeLoadBalancers.")
+	certificates    = flag.Bool("collector.certificates", false, "Export the expiry time of server certificates bound to HTTPS listeners.")
+	nlb             = flag.Bool("collector.nlb", false, "Also export the acs_nlb metrics of Network Load Balancers through the same collection path.")
 	//insecure        = flag.Bool("insecure", true, "Ignore server certificate if using https")
 )
 
 func main() {
 	flag.Parse()
 	exporter := newExporter()
+	var err error
+	exporter.aggregations, err = cmsutil.ParseAggregations(*aggregate, exporter.newStatusMetric, metricLabels, newECSMetric)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exporter.keepRaw = *aggregateRaw
+	exporter.lookback = *lookback
+	exporter.cache = cmsutil.NewStaleCache(*staleGrace)
+	exporter.backendHealth = *backendHealth
+	exporter.inventory = *inventory
+	exporter.certificates = *certificates
+	// The series limits apply to the NLB metrics too, so they may name
+	// either.
+	metrics := map[string]*prometheus.Desc{}
+	for metric, desc := range exporter.newStatusMetric {
+		metrics[metric] = desc
+	}
+	if *nlb {
+		exporter.nlb = newNLBExporter()
+		exporter.nlb.lookback = *lookback
+		exporter.nlb.cache = exporter.cache
+		for metric, desc := range exporter.nlb.newStatusMetric {
+			metrics[metric] = desc
+		}
+	}
+	limits, err := cmsutil.ParseMetricLimits(*metricLimits, metrics, exporter.aggregations)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exporter.limiter = cmsutil.NewSeriesLimiter(namespace, *seriesLimit, limits)
+	if exporter.nlb != nil {
+		exporter.nlb.limiter = cmsutil.NewSeriesLimiter(nlbNamespace, *seriesLimit, limits)
+	}
 	prometheus.MustRegister(exporter)
 	prometheus.Unregister(prometheus.NewGoCollector())
 